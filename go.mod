@@ -1 +1,3 @@
 module WXF_IM
+
+go 1.27.1
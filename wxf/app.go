@@ -0,0 +1,118 @@
+package wxf
+
+import (
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"strings"
+)
+
+var ErrAppMismatch = errors.New("err:session of another app")
+
+// App is the configuration of a tenant, sessions of an App are isolated
+// from other Apps by Router
+type App struct {
+	ID string
+	// Commands allowed in the App, all commands are allowed if empty
+	Commands []string
+	// Features are switches and settings of the App read by handlers
+	Features map[string]string
+}
+
+// Allow reports whether command is allowed in the App
+func (a *App) Allow(command string) bool {
+	if len(a.Commands) == 0 {
+		return true
+	}
+	for _, c := range a.Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// Feature returns the setting of name in the App
+func (a *App) Feature(name string) (string, bool) {
+	v, ok := a.Features[name]
+	return v, ok
+}
+
+// AppScoped returns id in the namespace of app, it is the key of accounts
+// in SessionStorage and should be the key of groups and messages in other
+// storages, so that they are never addressed from another App
+func AppScoped(app, id string) string {
+	if app == "" {
+		return id
+	}
+	return app + ":" + id
+}
+
+// GetSession returns the session of channelId from a storage which is
+// not scoped, the account of session is out of the namespace of its app
+func GetSession(storage SessionStorage, channelId string) (*pkt.Session, error) {
+	session, err := storage.Get(channelId)
+	if err != nil {
+		return nil, err
+	}
+	if session.App == "" {
+		return session, nil
+	}
+	session = proto.Clone(session).(*pkt.Session)
+	session.Account = strings.TrimPrefix(session.Account, session.App+":")
+	return session, nil
+}
+
+// appStorage scopes accounts of SessionStorage by app
+type appStorage struct {
+	SessionStorage
+	app string
+}
+
+// NewAppStorage returns a SessionStorage which only reaches sessions of app
+func NewAppStorage(storage SessionStorage, app string) SessionStorage {
+	if app == "" {
+		return storage
+	}
+	return &appStorage{SessionStorage: storage, app: app}
+}
+
+func (s *appStorage) Add(session *pkt.Session) error {
+	if session.App != s.app {
+		return ErrAppMismatch
+	}
+	scoped := proto.Clone(session).(*pkt.Session)
+	scoped.Account = AppScoped(s.app, session.Account)
+	return s.SessionStorage.Add(scoped)
+}
+
+func (s *appStorage) Delete(account string, channelId string) error {
+	return s.SessionStorage.Delete(AppScoped(s.app, account), channelId)
+}
+
+func (s *appStorage) Get(channelId string) (*pkt.Session, error) {
+	session, err := GetSession(s.SessionStorage, channelId)
+	if err != nil {
+		return nil, err
+	}
+	if session.App != s.app {
+		return nil, ErrSessionNil
+	}
+	return session, nil
+}
+
+func (s *appStorage) GetLocations(accounts ...string) ([]*Location, error) {
+	scoped := make([]string, len(accounts))
+	for i, account := range accounts {
+		scoped[i] = AppScoped(s.app, account)
+	}
+	return s.SessionStorage.GetLocations(scoped...)
+}
+
+func (s *appStorage) ListLocations(account string) ([]*Location, error) {
+	return ListLocations(s.SessionStorage, AppScoped(s.app, account))
+}
+
+func (s *appStorage) GetLocation(account string, device string) (*Location, error) {
+	return s.SessionStorage.GetLocation(AppScoped(s.app, account), device)
+}
@@ -3,19 +3,36 @@ package wxf
 import (
 	"errors"
 	"github.com/sirupsen/logrus"
+	"github.com/wangxuefeng90923/wxf/metrics"
 	"sync"
 	"time"
 )
 
+var (
+	ErrChannelClosed = errors.New("channel has closed")
+	ErrPushQueueFull = errors.New("push queue of channel is full")
+	ErrFrameTooLarge = errors.New("frame exceeds the max frame size of channel")
+)
+
+var (
+	framesIn  = metrics.ChannelFramesTotal.WithLabelValues(metrics.DirectionIn)
+	framesOut = metrics.ChannelFramesTotal.WithLabelValues(metrics.DirectionOut)
+	bytesIn   = metrics.ChannelBytesTotal.WithLabelValues(metrics.DirectionIn)
+	bytesOut  = metrics.ChannelBytesTotal.WithLabelValues(metrics.DirectionOut)
+)
+
 type ChannelImpl struct {
 	sync.Mutex
 	id string
 	Conn
-	writeChan chan []byte
+	writeChan chan *PreparedFrame
 	sync.Once
 	writeWait time.Duration
 	readWait  time.Duration
-	closed    *Event
+	encoder   FrameEncoder
+	// maxFrameSize of payloads read or written, 0 for unlimited
+	maxFrameSize uint32
+	closed       *Event
 }
 
 func NewChannel(id string, conn Conn) Channel {
@@ -26,7 +43,7 @@ func NewChannel(id string, conn Conn) Channel {
 	ch := &ChannelImpl{
 		id:        id,
 		Conn:      conn,
-		writeChan: make(chan []byte, 5),
+		writeChan: make(chan *PreparedFrame, 5),
 		writeWait: time.Second * 10,
 		closed:    NewEvent(),
 	}
@@ -39,18 +56,25 @@ func NewChannel(id string, conn Conn) Channel {
 	return ch
 }
 
+// writeLoop writes frames in the write queue until the channel is closed
+// or it fails to write, the channel is closed for pushes then and frames
+// left in the queue are released
 func (c *ChannelImpl) writeLoop() error {
+	defer func() {
+		c.closed.Fire()
+		c.drain()
+	}()
 	for {
 		select {
-		case payload := <-c.writeChan:
-			err := c.WriteFrame(OpBinary, payload)
+		case frame := <-c.writeChan:
+			err := c.writePrepared(frame)
 			if err != nil {
 				return err
 			}
 			chanLen := len(c.writeChan)
 			for i := 0; i < chanLen; i++ {
-				payload = <-c.writeChan
-				err := c.WriteFrame(OpBinary, payload)
+				frame = <-c.writeChan
+				err := c.writePrepared(frame)
 				if err != nil {
 					return err
 				}
@@ -65,6 +89,54 @@ func (c *ChannelImpl) writeLoop() error {
 	}
 }
 
+// drain releases frames left in the write queue
+func (c *ChannelImpl) drain() {
+	for {
+		select {
+		case frame := <-c.writeChan:
+			frame.Release()
+		default:
+			return
+		}
+	}
+}
+
+func (c *ChannelImpl) writePrepared(frame *PreparedFrame) error {
+	defer frame.Release()
+	if c.encoder != nil {
+		code, payload, err := frame.Encode(c.encoder)
+		if err == nil && c.oversized(len(payload)) {
+			err = ErrFrameTooLarge
+		}
+		if err != nil {
+			// the payload is dropped, the channel is still fine
+			logrus.WithField("id", c.id).Warn(err)
+			return nil
+		}
+		return c.WriteFrame(code, payload)
+	}
+	if c.oversized(len(frame.Payload)) {
+		logrus.WithField("id", c.id).Warn(ErrFrameTooLarge)
+		return nil
+	}
+	preparer, ok := c.Conn.(FramePreparer)
+	if !ok {
+		return c.WriteFrame(frame.OpCode, frame.Payload)
+	}
+	data, err := frame.Data(preparer)
+	if err != nil {
+		logrus.WithField("id", c.id).Warn(err)
+		return nil
+	}
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+	_, err = c.Conn.Write(data)
+	if err == nil {
+		framesOut.Inc()
+		bytesOut.Add(float64(len(frame.Payload)))
+	}
+	return err
+}
+
 // Readloop could only be visited by one thread one time
 // it is a block method
 func (c *ChannelImpl) Readloop(msgLst MessageListener) error {
@@ -93,6 +165,11 @@ func (c *ChannelImpl) Readloop(msgLst MessageListener) error {
 		if len(payload) == 0 {
 			continue
 		}
+		if c.oversized(len(payload)) {
+			return ErrFrameTooLarge
+		}
+		framesIn.Inc()
+		bytesIn.Add(float64(len(payload)))
 		go msgLst.Receive(c, payload)
 	}
 }
@@ -101,19 +178,60 @@ func (c *ChannelImpl) Readloop(msgLst MessageListener) error {
 // enforcing it with setting write deadline
 func (c *ChannelImpl) WriteFrame(code OpCode, payload []byte) error {
 	_ = c.Conn.SetWriteDeadline(time.Now().Add(c.writeWait))
-	return c.Conn.WriteFrame(code, payload)
+	err := c.Conn.WriteFrame(code, payload)
+	if err == nil {
+		framesOut.Inc()
+		bytesOut.Add(float64(len(payload)))
+	}
+	return err
+}
+
+// Close overwrite Conn, it stops the writeLoop as well
+func (c *ChannelImpl) Close() error {
+	c.closed.Fire()
+	return c.Conn.Close()
 }
 
 func (c *ChannelImpl) ID() string {
 	return c.id
 }
 
+// Push put payload into the write queue, the payload is dropped
+// if the queue is still full after writeWait
 func (c *ChannelImpl) Push(payload []byte) error {
+	return c.PushFrame(NewPreparedFrame(OpBinary, payload))
+}
+
+// PushFrame put a frame shared with other channels into the write queue
+func (c *ChannelImpl) PushFrame(frame *PreparedFrame) error {
+	if c.closed.HasFired() {
+		return ErrChannelClosed
+	}
+	select {
+	case c.writeChan <- frame:
+		c.drainClosed()
+		return nil
+	default:
+	}
+	timer := time.NewTimer(c.writeWait)
+	defer timer.Stop()
+	select {
+	case c.writeChan <- frame:
+		c.drainClosed()
+		return nil
+	case <-c.closed.Done():
+		return ErrChannelClosed
+	case <-timer.C:
+		metrics.PushDropTotal.Inc()
+		return ErrPushQueueFull
+	}
+}
+
+// drainClosed releases frames queued after the writeLoop exits
+func (c *ChannelImpl) drainClosed() {
 	if c.closed.HasFired() {
-		return errors.New("channel has closed")
+		c.drain()
 	}
-	c.writeChan <- payload
-	return nil
 }
 
 func (c *ChannelImpl) SetWriteWait(duration time.Duration) {
@@ -123,6 +241,20 @@ func (c *ChannelImpl) SetWriteWait(duration time.Duration) {
 	c.writeWait = duration
 }
 
+// SetFrameEncoder must be called before any payload is pushed
+func (c *ChannelImpl) SetFrameEncoder(encoder FrameEncoder) {
+	c.encoder = encoder
+}
+
+// SetMaxFrameSize must be called before Readloop and any payload is pushed
+func (c *ChannelImpl) SetMaxFrameSize(size uint32) {
+	c.maxFrameSize = size
+}
+
+func (c *ChannelImpl) oversized(n int) bool {
+	return c.maxFrameSize > 0 && n > int(c.maxFrameSize)
+}
+
 func (c *ChannelImpl) SetReadWait(duration time.Duration) {
 	if duration == 0 {
 		return
@@ -0,0 +1,105 @@
+package container_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/container"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"github.com/wangxuefeng90923/wxf/naming/memory"
+	"github.com/wangxuefeng90923/wxf/services/gateway/serv"
+	"github.com/wangxuefeng90923/wxf/tcp"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"net"
+	"testing"
+	"time"
+)
+
+type logicHandler struct {
+	received chan *pkt.LogicPkt
+}
+
+func (h *logicHandler) Accept(conn wxf.Conn, timeout time.Duration) (string, error) {
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		return "", err
+	}
+	var req pkt.InnerHandshakeReq
+	err = proto.Unmarshal(frame.GetPayload(), &req)
+	return req.ServiceId, err
+}
+
+func (h *logicHandler) Receive(agent wxf.Agent, payload []byte) {
+	packet, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+	if err != nil {
+		return
+	}
+	h.received <- packet
+}
+
+func (h *logicHandler) Disconnect(string) error {
+	return nil
+}
+
+func freePort(t *testing.T) int {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lst.Close()
+	return lst.Addr().(*net.TCPAddr).Port
+}
+
+func TestCluster(t *testing.T) {
+	ns := memory.NewNaming()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// logic service
+	port := freePort(t)
+	handler := &logicHandler{received: make(chan *pkt.LogicPkt, 1)}
+	logicSrv := tcp.NewServer(net.JoinHostPort("127.0.0.1", fmt.Sprint(port)), &naming.DefaultService{
+		Id:       "chat01",
+		Name:     wire.SNChat,
+		Address:  "127.0.0.1",
+		Port:     port,
+		Protocol: string(wire.ProtocolTCP),
+	})
+	logicSrv.SetAcceptor(handler)
+	logicSrv.SetMessageListener(handler)
+	logicSrv.SetStateListener(handler)
+	logic := container.New()
+	assert.Nil(t, logic.Init(logicSrv))
+	logic.SetServiceNaming(ns)
+	go func() {
+		_ = logic.Start(ctx)
+	}()
+	assert.Eventually(t, logic.Ready, time.Second*5, time.Millisecond*10)
+
+	// gateway
+	gatewaySrv := tcp.NewServer("127.0.0.1:0", &naming.DefaultService{Id: "gateway01", Name: wire.SNTGateway})
+	gatewaySrv.SetStateListener(handler)
+	gateway := container.New()
+	assert.Nil(t, gateway.Init(gatewaySrv, wire.SNChat))
+	gateway.SetServiceNaming(ns)
+	gateway.SetDialer(serv.NewDialer("gateway01"))
+	go func() {
+		_ = gateway.Start(ctx)
+	}()
+	assert.Eventually(t, gateway.Ready, time.Second*5, time.Millisecond*10)
+
+	packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("gateway01_test1_1"), pkt.WithDest("test2"))
+	assert.Nil(t, gateway.Forward(wire.SNChat, packet))
+
+	select {
+	case received := <-handler.received:
+		assert.Equal(t, wire.CommandChatUserTalk, received.Command)
+		assert.Equal(t, "test2", received.Dest)
+		server, _ := received.GetMeta(wire.MetaDestServer)
+		assert.Equal(t, "gateway01", server)
+	case <-time.After(time.Second * 5):
+		t.Fatal("packet is not forwarded")
+	}
+}
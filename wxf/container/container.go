@@ -1,17 +1,18 @@
 package container
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/metrics"
 	"github.com/wangxuefeng90923/wxf/naming"
 	"github.com/wangxuefeng90923/wxf/tcp"
+	"github.com/wangxuefeng90923/wxf/tracing"
 	"github.com/wangxuefeng90923/wxf/wire"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
-	"os"
+	"go.opentelemetry.io/otel/trace"
 	"os/signal"
 	"strings"
 	"sync"
@@ -33,7 +34,9 @@ const (
 )
 
 const (
-	KeyServiceState = "service_state"
+	KeyServiceState  = "service_state"
+	KeyServiceWeight = "weight"
+	KeyServiceZone   = "zone"
 )
 
 type Container struct {
@@ -43,16 +46,26 @@ type Container struct {
 	state      uint32
 	srvClients map[string]ClientMap
 	selector   Selector
+	selectors  map[string]Selector
 	dialer     wxf.Dialer
 	deps       map[string]struct{}
+	monitor    *monitor
+	draining   int32
 }
 
 var log = logrus.WithField("module", "container")
 
-var c = &Container{
-	state:    0,
-	selector: &HashSelector{},
-	deps:     make(map[string]struct{}),
+var c = New()
+
+// New create a Container, most processes only need the
+// Default one, which is used by the package level functions
+func New() *Container {
+	return &Container{
+		state:     stateUninitialized,
+		selector:  &HashSelector{},
+		selectors: make(map[string]Selector),
+		deps:      make(map[string]struct{}),
+	}
 }
 
 func Default() *Container {
@@ -60,6 +73,10 @@ func Default() *Container {
 }
 
 func Init(srv wxf.Server, deps ...string) error {
+	return c.Init(srv, deps...)
+}
+
+func (c *Container) Init(srv wxf.Server, deps ...string) error {
 	if !atomic.CompareAndSwapUint32(&c.state, stateUninitialized, stateInitialized) {
 		return errors.New("has Initialized")
 	}
@@ -76,24 +93,33 @@ func Init(srv wxf.Server, deps ...string) error {
 	return nil
 }
 
-func Start() error {
+func Start(ctx context.Context) error {
+	return c.Start(ctx)
+}
+
+// Start starts the server, connects to dependent services and registers
+// itself. It blocks until ctx is done or the server stops, and then
+// shuts the container down, use WithSignal to stop it on OS signals
+func (c *Container) Start(ctx context.Context) error {
 	if c.Naming == nil {
 		return fmt.Errorf("naming is nil")
 	}
 	if !atomic.CompareAndSwapUint32(&c.state, stateInitialized, stateStarted) {
 		return errors.New("has started")
 	}
+	// 0. start monitor
+	if err := c.startMonitor(); err != nil {
+		return err
+	}
 	// 1.start Server
+	srvErr := make(chan error, 1)
 	go func(srv wxf.Server) {
-		err := srv.Start()
-		if err != nil {
-			log.Errorln(err)
-		}
+		srvErr <- srv.Start()
 	}(c.Srv)
 	// 2. connect to dependent services
 	for service := range c.deps {
 		go func(service string) {
-			err := connectToService(service)
+			err := c.connectToService(service)
 			if err != nil {
 				log.Errorln(err)
 			}
@@ -105,24 +131,89 @@ func Start() error {
 		if err != nil {
 			log.Errorln(err)
 		}
+		if hb, ok := c.Naming.(naming.Heartbeater); ok && hb.HeartbeatInterval() > 0 {
+			hbCtx, stop := context.WithCancel(ctx)
+			defer stop()
+			go c.heartbeat(hbCtx, hb)
+		}
+	}
+	// wait for ctx being done or server stopped
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Infoln("shutdown", ctx.Err())
+	case err = <-srvErr:
+		log.Errorln("server stopped", err)
 	}
-	// wait for quit signal of system
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-
-	log.Infoln("shutdown", <-c)
 	// 4. 退出
-	return shutdown()
+	if e := c.shutdown(); e != nil {
+		return e
+	}
+	return err
+}
+
+// heartbeat keeps the registration alive while the server is listening
+// and not draining, until ctx is done
+func (c *Container) heartbeat(ctx context.Context, hb naming.Heartbeater) {
+	tick := time.NewTicker(hb.HeartbeatInterval())
+	defer tick.Stop()
+	for {
+		if c.alive() {
+			if err := hb.Heartbeat(c.Srv.ServiceID()); err != nil {
+				log.Warnf("heartbeat of %s failed: %v", c.Srv.ServiceID(), err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (c *Container) alive() bool {
+	if atomic.LoadUint32(&c.state) != stateStarted || atomic.LoadInt32(&c.draining) == 1 {
+		return false
+	}
+	if l, ok := c.Srv.(Listening); ok && !l.Listening() {
+		return false
+	}
+	return true
+}
+
+// WithSignal returns a copy of parent which is done when the process
+// receives a quit signal of system
+func WithSignal(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 }
 
 // Push (logic service downstream) push message to server(gateway)
 func Push(server string, p *pkt.LogicPkt) error {
-	p.AddStringMeta(wire.MetaDestServer, server)
+	return c.Push(server, p)
+}
+
+func (c *Container) Push(server string, p *pkt.LogicPkt) error {
+	_, span := tracing.Start(&p.Header, "container.push", trace.WithSpanKind(trace.SpanKindProducer))
+	span.SetAttributes(tracing.GatewayKey.String(server))
+	defer span.End()
+	p.SetStringMeta(wire.MetaDestServer, server)
 	return c.Srv.Push(server, pkt.Marshal(p))
 }
 
 // Forward (gateway service upstream) forward message to server(logic service)
 func Forward(serviceName string, packet *pkt.LogicPkt) error {
+	return c.Forward(serviceName, packet)
+}
+
+func (c *Container) Forward(serviceName string, packet *pkt.LogicPkt) error {
+	err := c.forward(serviceName, packet)
+	if err != nil {
+		metrics.ForwardErrorTotal.WithLabelValues(serviceName).Inc()
+	}
+	return err
+}
+
+func (c *Container) forward(serviceName string, packet *pkt.LogicPkt) error {
 	if packet == nil {
 		return errors.New("packet is nil")
 	}
@@ -132,21 +223,63 @@ func Forward(serviceName string, packet *pkt.LogicPkt) error {
 	if packet.ChannelId == "" {
 		return errors.New("ChannelId is empty in packet")
 	}
-	return ForwardWithSelector(serviceName, packet, c.selector)
+	return c.ForwardWithSelector(serviceName, packet, c.selectorOf(serviceName))
 }
 
 func ForwardWithSelector(serviceName string, packet *pkt.LogicPkt, selector Selector) error {
-	cli, err := lookup(serviceName, &packet.Header, selector)
+	return c.ForwardWithSelector(serviceName, packet, selector)
+}
+
+func (c *Container) ForwardWithSelector(serviceName string, packet *pkt.LogicPkt, selector Selector) error {
+	cli, err := c.lookup(serviceName, &packet.Header, selector)
 	if err != nil {
 		return err
 	}
-	packet.AddStringMeta(wire.MetaDestServer, c.Srv.ServiceID())
+	_, span := tracing.Start(&packet.Header, "container.forward", trace.WithSpanKind(trace.SpanKindProducer))
+	span.SetAttributes(tracing.ServiceKey.String(serviceName), tracing.ServiceIDKey.String(cli.ID()))
+	defer span.End()
+	packet.SetStringMeta(wire.MetaDestServer, c.Srv.ServiceID())
 	log.Debugf("forward message to %v with %s", cli.ID(), &packet.Header)
-	return cli.Send(pkt.Marshal(packet))
+	// Begin before Send, or a fast response could be Done before it
+	tracker, ok := selector.(LoadTracker)
+	ok = ok && packet.Flag == pkt.Flag_Request
+	if ok {
+		tracker.Begin(cli.ID())
+	}
+	// Send writes the bytes before it returns, the buffer is reused after
+	buf, err := pkt.Encode(packet)
+	if err != nil {
+		if ok {
+			tracker.Done(cli.ID())
+		}
+		span.RecordError(err)
+		return err
+	}
+	err = cli.Send(buf.Bytes())
+	buf.Free()
+	if err != nil {
+		if ok {
+			tracker.Done(cli.ID())
+		}
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Container) selectorOf(serviceName string) Selector {
+	c.RLock()
+	defer c.RUnlock()
+	if selector, ok := c.selectors[serviceName]; ok {
+		return selector
+	}
+	return c.selector
 }
 
-func lookup(serviceName string, header *pkt.Header, selector Selector) (wxf.Client, error) {
+func (c *Container) lookup(serviceName string, header *pkt.Header, selector Selector) (wxf.Client, error) {
+	c.RLock()
 	clients, ok := c.srvClients[serviceName]
+	c.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("service %s not found", serviceName)
 	}
@@ -156,6 +289,7 @@ func lookup(serviceName string, header *pkt.Header, selector Selector) (wxf.Clie
 		return nil, fmt.Errorf("no services found for %s", serviceName)
 	}
 	id := selector.Lookup(header, srvs)
+	metrics.SelectorDecisionTotal.WithLabelValues(serviceName, id).Inc()
 	if cli, ok := clients.Get(id); ok {
 		return cli, nil
 	}
@@ -163,7 +297,7 @@ func lookup(serviceName string, header *pkt.Header, selector Selector) (wxf.Clie
 }
 
 // PushMessage (gateway service downstream) push message to Channel
-func pushMessage(packet *pkt.LogicPkt) error {
+func (c *Container) pushMessage(packet *pkt.LogicPkt) error {
 	server, _ := packet.GetMeta(wire.MetaDestServer)
 	if server != c.Srv.ServiceID() {
 		return fmt.Errorf("dest_server is incorrect, %s != %s",
@@ -174,44 +308,64 @@ func pushMessage(packet *pkt.LogicPkt) error {
 		return fmt.Errorf("dest_channels is nil")
 	}
 	channelIds := strings.Split(channels.(string), ",")
+	_, span := tracing.Start(&packet.Header, "container.pushMessage", trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
 	packet.DelMeta(wire.MetaDestServer)
 	packet.DelMeta(wire.MetaDestChannels)
-	payload := pkt.Marshal(packet)
+	// trace IDs are internal, they are not pushed to clients
+	tracing.Strip(&packet.Header)
+	buf, err := pkt.Encode(packet)
+	if err != nil {
+		return err
+	}
 	log.Debugf("Push to %v %v", channelIds, packet)
 
+	// the frame is encoded once and shared by all channels, the buffer
+	// is put back to pool after all of them wrote or dropped it
+	frame := wxf.NewPreparedFrame(wxf.OpBinary, buf.Bytes())
+	frame.SetRelease(len(channelIds), buf.Free)
 	for _, channel := range channelIds {
-		err := c.Srv.Push(channel, payload)
+		err := c.Srv.PushFrame(channel, frame)
 		if err != nil {
+			frame.Release()
 			log.Debug(err)
 		}
 	}
 	return nil
 }
 
-func shutdown() error {
+func (c *Container) shutdown() error {
 	if !atomic.CompareAndSwapUint32(&c.state, stateStarted, stateClosed) {
 		return errors.New("has closed")
 	}
+	// readiness fails from now on
+	atomic.StoreInt32(&c.draining, 1)
 	ctx, cancelFunc := context.WithTimeout(context.TODO(), time.Second*10)
 	defer cancelFunc()
-	err := c.Srv.Shutdown(ctx)
+	err := c.Naming.Deregister(c.Srv.ServiceID())
 	if err != nil {
 		log.Error(err)
 	}
-	err = c.Naming.Deregister(c.Srv.ServiceID())
+	err = c.Srv.Shutdown(ctx)
 	if err != nil {
 		log.Error(err)
 	}
 	for dep := range c.deps {
 		_ = c.Naming.Unsubscribe(dep)
 	}
+	err = c.stopMonitor(ctx)
+	if err != nil {
+		log.Error(err)
+	}
 	log.Infoln("shutdown")
 	return nil
 }
 
-func connectToService(serviceName string) error {
+func (c *Container) connectToService(serviceName string) error {
 	clients := NewClients(10)
+	c.Lock()
 	c.srvClients[serviceName] = clients
+	c.Unlock()
 	// 1. watch a new added service
 	delay := time.Second * 10
 	err := c.Naming.Subscribe(serviceName, func(services []wxf.ServiceRegistration) {
@@ -226,7 +380,7 @@ func connectToService(serviceName string) error {
 				service.GetMeta()[KeyServiceState] = StateAdult
 			}(service)
 
-			_, err := buildClient(clients, service)
+			_, err := c.buildClient(clients, service)
 			if err != nil {
 				logrus.Warn(err)
 			}
@@ -243,7 +397,7 @@ func connectToService(serviceName string) error {
 	log.Info("find service: ", services)
 	for _, service := range services {
 		service.GetMeta()[KeyServiceState] = StateAdult
-		_, err := buildClient(clients, service)
+		_, err := c.buildClient(clients, service)
 		if err != nil {
 			logrus.Warn(err)
 		}
@@ -252,7 +406,7 @@ func connectToService(serviceName string) error {
 }
 
 // BuildClient: connect to the service after being discovered
-func buildClient(clients ClientMap, service wxf.ServiceRegistration) (wxf.Client, error) {
+func (c *Container) buildClient(clients ClientMap, service wxf.ServiceRegistration) (wxf.Client, error) {
 	c.Lock()
 	defer c.Unlock()
 	var (
@@ -282,18 +436,20 @@ func buildClient(clients ClientMap, service wxf.ServiceRegistration) (wxf.Client
 	}
 	// read messages
 	go func(cli wxf.Client) {
-		readLoop(cli)
+		c.readLoop(cli)
 	}(cli)
 	clients.Add(cli)
 	return cli, nil
 }
 
-func readLoop(cli wxf.Client) error {
+func (c *Container) readLoop(cli wxf.Client) error {
 	logrus.WithFields(logrus.Fields{
 		"module": "container",
 		"func":   "readLoop",
 	})
 	log.Infof("readLoop started of %s %s", cli.ID(), cli.Name())
+	// the packet is reused, its body refers to the payload of each frame
+	var logicPkt pkt.LogicPkt
 	for {
 		frame, err := cli.Read()
 		if err != nil {
@@ -302,13 +458,16 @@ func readLoop(cli wxf.Client) error {
 		if frame.GetOpCode() != wxf.OpBinary {
 			continue
 		}
-		buf := bytes.NewBuffer(frame.GetPayload())
-		logicPkt, err := pkt.MustReadLogicPkt(buf)
-		if err != nil {
+		if err = pkt.MustUnmarshalLogicPkt(frame.GetPayload(), &logicPkt); err != nil {
 			log.Info(err)
 			continue
 		}
-		err = pushMessage(logicPkt)
+		if logicPkt.Flag == pkt.Flag_Response {
+			if tracker, ok := c.selectorOf(cli.Name()).(LoadTracker); ok {
+				tracker.Done(cli.ID())
+			}
+		}
+		err = c.pushMessage(&logicPkt)
 		if err != nil {
 			log.Info(err)
 		}
@@ -316,13 +475,37 @@ func readLoop(cli wxf.Client) error {
 }
 
 func SetDialer(dialer wxf.Dialer) {
+	c.SetDialer(dialer)
+}
+
+func (c *Container) SetDialer(dialer wxf.Dialer) {
 	c.dialer = dialer
 }
 
 func SetSelector(selector Selector) {
+	c.SetSelector(selector)
+}
+
+func (c *Container) SetSelector(selector Selector) {
 	c.selector = selector
 }
 
+// SetServiceSelector set the selector used to forward messages to serviceName,
+// services without a selector of their own use the default one
+func SetServiceSelector(serviceName string, selector Selector) {
+	c.SetServiceSelector(serviceName, selector)
+}
+
+func (c *Container) SetServiceSelector(serviceName string, selector Selector) {
+	c.Lock()
+	defer c.Unlock()
+	c.selectors[serviceName] = selector
+}
+
 func SetServiceNaming(nm naming.Naming) {
+	c.SetServiceNaming(nm)
+}
+
+func (c *Container) SetServiceNaming(nm naming.Naming) {
 	c.Naming = nm
 }
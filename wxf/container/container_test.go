@@ -0,0 +1,236 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"github.com/wangxuefeng90923/wxf/tcp"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContainerInstances(t *testing.T) {
+	gateway := New()
+	logic := New()
+
+	err := gateway.Init(tcp.NewServer(":0", &naming.DefaultService{Id: "gateway01"}), "chat")
+	assert.Nil(t, err)
+	err = logic.Init(tcp.NewServer(":0", &naming.DefaultService{Id: "chat01"}))
+	assert.Nil(t, err)
+	// each instance can only be initialized once
+	err = gateway.Init(tcp.NewServer(":0", &naming.DefaultService{Id: "gateway02"}))
+	assert.NotNil(t, err)
+
+	gateway.SetServiceSelector("chat", NewLeastLoadSelector())
+	assert.IsType(t, &LeastLoadSelector{}, gateway.selectorOf("chat"))
+	assert.IsType(t, &HashSelector{}, logic.selectorOf("chat"))
+
+	assert.NotSame(t, Default(), gateway)
+	assert.Equal(t, "gateway01", gateway.Srv.ServiceID())
+	assert.Equal(t, "chat01", logic.Srv.ServiceID())
+}
+
+type fakeNaming struct {
+	naming.Naming
+}
+
+func (n *fakeNaming) Deregister(string) error {
+	return nil
+}
+
+func (n *fakeNaming) Unsubscribe(string) error {
+	return nil
+}
+
+type heartbeatNaming struct {
+	fakeNaming
+	beats chan string
+}
+
+func (n *heartbeatNaming) Register(wxf.ServiceRegistration) error {
+	return nil
+}
+
+func (n *heartbeatNaming) Heartbeat(serviceID string) error {
+	n.beats <- serviceID
+	return nil
+}
+
+func (n *heartbeatNaming) HeartbeatInterval() time.Duration {
+	return time.Millisecond * 20
+}
+
+type fakeListener struct {
+}
+
+func (l *fakeListener) Disconnect(string) error {
+	return nil
+}
+
+func TestContainerStartWithContext(t *testing.T) {
+	srv := tcp.NewServer("127.0.0.1:0", &naming.DefaultService{Id: "chat01"})
+	srv.SetStateListener(&fakeListener{})
+
+	ctr := New()
+	assert.Nil(t, ctr.Init(srv))
+	ctr.SetServiceNaming(&fakeNaming{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ctr.Start(ctx)
+	}()
+	time.Sleep(time.Millisecond * 100)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("container is not stopped")
+	}
+	// a closed container can not be started again
+	assert.NotNil(t, ctr.Start(context.Background()))
+}
+
+func TestContainerMonitor(t *testing.T) {
+	srv := tcp.NewServer("127.0.0.1:0", &naming.DefaultService{Id: "chat02"})
+	srv.SetStateListener(&fakeListener{})
+
+	ctr := New()
+	assert.Nil(t, ctr.Init(srv))
+	ctr.SetServiceNaming(&fakeNaming{})
+	ctr.SetMonitor("127.0.0.1:0")
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		ctr.monitor.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get(MonitorPathHealth))
+	assert.Equal(t, http.StatusServiceUnavailable, get(MonitorPathReady))
+	assert.Equal(t, http.StatusOK, get(MonitorPathMetrics))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ctr.Start(ctx)
+	}()
+	assert.Eventually(t, ctr.Ready, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, http.StatusOK, get(MonitorPathReady))
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, http.StatusServiceUnavailable, get(MonitorPathReady))
+}
+
+func TestContainerHeartbeat(t *testing.T) {
+	srv := tcp.NewServer("127.0.0.1:0", &naming.DefaultService{Id: "chat03", Address: "127.0.0.1", Port: 8000})
+	srv.SetStateListener(&fakeListener{})
+
+	ctr := New()
+	assert.Nil(t, ctr.Init(srv))
+	ns := &heartbeatNaming{beats: make(chan string, 100)}
+	ctr.SetServiceNaming(ns)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ctr.Start(ctx)
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-ns.beats:
+			assert.Equal(t, "chat03", id)
+		case <-time.After(time.Second * 5):
+			t.Fatal("no heartbeat")
+		}
+	}
+	cancel()
+	assert.Nil(t, <-done)
+}
+
+// stubClient calls onSend and returns err in Send
+type stubClient struct {
+	wxf.Client
+	*naming.DefaultService
+	err    error
+	onSend func()
+}
+
+func (f *stubClient) ID() string { return f.DefaultService.ServiceID() }
+
+func (f *stubClient) Name() string { return f.DefaultService.ServiceName() }
+
+func (f *stubClient) Send([]byte) error {
+	if f.onSend != nil {
+		f.onSend()
+	}
+	return f.err
+}
+
+func TestForwardPending(t *testing.T) {
+	ctr := New()
+	assert.Nil(t, ctr.Init(tcp.NewServer(":0", &naming.DefaultService{Id: "gateway01"}), "chat"))
+	cli := &stubClient{DefaultService: &naming.DefaultService{
+		Id:   "chat01",
+		Name: "chat",
+		Meta: map[string]string{KeyServiceState: StateAdult},
+	}}
+	clients := NewClients(1)
+	clients.Add(cli)
+	ctr.srvClients["chat"] = clients
+	selector := NewLeastLoadSelector()
+
+	// the response arrives before Send returns
+	cli.onSend = func() {
+		selector.Done("chat01")
+	}
+	packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("gateway01_test1_1"))
+	assert.Nil(t, ctr.ForwardWithSelector("chat", packet, selector))
+	assert.Equal(t, int64(0), selector.Pending("chat01"))
+
+	// pending is released if it fails to send
+	cli.onSend = nil
+	cli.err = errors.New("broken pipe")
+	assert.NotNil(t, ctr.ForwardWithSelector("chat", packet, selector))
+	assert.Equal(t, int64(0), selector.Pending("chat01"))
+}
+
+// frameServer records frames pushed to channels
+type frameServer struct {
+	wxf.Server
+	frames map[string]*wxf.PreparedFrame
+}
+
+func (s *frameServer) ServiceID() string { return "gateway01" }
+
+func (s *frameServer) PushFrame(id string, frame *wxf.PreparedFrame) error {
+	s.frames[id] = frame
+	return nil
+}
+
+func TestPushMessageStripsMeta(t *testing.T) {
+	srv := &frameServer{frames: map[string]*wxf.PreparedFrame{}}
+	ctr := &Container{Srv: srv}
+	packet := pkt.New(wire.CommandChatUserTalk)
+	packet.SetStringMeta(wire.MetaDestServer, "gateway01")
+	packet.SetStringMeta(wire.MetaDestChannels, "ch1,ch2")
+	packet.SetStringMeta(wire.MetaTraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	packet.SetStringMeta(wire.MetaSpanID, "00f067aa0ba902b7")
+	packet.SetStringMeta("app", "wxf")
+	assert.Nil(t, ctr.pushMessage(packet))
+
+	assert.Equal(t, 2, len(srv.frames))
+	pushed, err := pkt.MustReadLogicPkt(bytes.NewBuffer(srv.frames["ch1"].Payload))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pushed.Meta))
+	assert.Equal(t, "app", pushed.Meta[0].Key)
+}
@@ -1,15 +1,67 @@
 package container
 
 import (
+	"fmt"
 	"github.com/wangxuefeng90923/wxf"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"strings"
 )
 
+const (
+	HashKeyChannel    = "channel"
+	HashKeyDest       = "dest"
+	HashKeyMetaPrefix = "meta."
+)
+
+// HashKeyFunc returns the key of a packet to hash on
+type HashKeyFunc func(header *pkt.Header) string
+
 type HashSelector struct {
+	// Key is the key to hash on, ChannelId is used if Key is nil
+	// or returns an empty string
+	Key HashKeyFunc
 }
 
 func (s *HashSelector) Lookup(header *pkt.Header, services []wxf.Service) string {
 	l := len(services)
-	code := HashCode(header.ChannelId)
+	key := header.ChannelId
+	if s.Key != nil {
+		if k := s.Key(header); k != "" {
+			key = k
+		}
+	}
+	code := HashCode(key)
 	return services[code%l].ServiceID()
 }
+
+// HashByDest hash on Header.Dest, so that packets of the same group
+// or room are always forwarded to the same service
+func HashByDest(header *pkt.Header) string {
+	return header.Dest
+}
+
+// HashByMeta hash on the value of meta key
+func HashByMeta(key string) HashKeyFunc {
+	return func(header *pkt.Header) string {
+		val, ok := pkt.FindMeta(header.Meta, key)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprint(val)
+	}
+}
+
+// ParseHashKey parse a key spec to HashKeyFunc, the spec is one of
+// "channel", "dest" or "meta.<key>"
+func ParseHashKey(spec string) (HashKeyFunc, error) {
+	switch {
+	case spec == "" || spec == HashKeyChannel:
+		return nil, nil
+	case spec == HashKeyDest:
+		return HashByDest, nil
+	case strings.HasPrefix(spec, HashKeyMetaPrefix) && len(spec) > len(HashKeyMetaPrefix):
+		return HashByMeta(strings.TrimPrefix(spec, HashKeyMetaPrefix)), nil
+	default:
+		return nil, fmt.Errorf("unknown hash key: %s", spec)
+	}
+}
@@ -0,0 +1,95 @@
+package container
+
+import (
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"sync"
+	"time"
+)
+
+// DefaultPendingTimeout is the time after which a request without
+// response is not counted as pending any more
+const DefaultPendingTimeout = time.Second * 30
+
+// LoadTracker is implemented by selectors which need to know
+// how many requests are in flight on each service
+type LoadTracker interface {
+	// Begin is called before a packet is forwarded to the service
+	Begin(serviceID string)
+	// Done is called when a response is received from the service,
+	// or the packet fails to be forwarded
+	Done(serviceID string)
+}
+
+// LeastLoadSelector selects the service with the least pending requests
+type LeastLoadSelector struct {
+	sync.Mutex
+	// Timeout of pending requests, DefaultPendingTimeout if 0
+	Timeout time.Duration
+	// pending holds the begin time of requests in order
+	pending map[string][]time.Time
+}
+
+func NewLeastLoadSelector() *LeastLoadSelector {
+	return &LeastLoadSelector{pending: make(map[string][]time.Time)}
+}
+
+func (s *LeastLoadSelector) Lookup(header *pkt.Header, services []wxf.Service) string {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	best := services[0]
+	bestLoad := s.count(best.ServiceID(), now)
+	for _, srv := range services[1:] {
+		load := s.count(srv.ServiceID(), now)
+		// ties are broken by ServiceID so that the choice is stable
+		if load < bestLoad || (load == bestLoad && srv.ServiceID() < best.ServiceID()) {
+			best, bestLoad = srv, load
+		}
+	}
+	return best.ServiceID()
+}
+
+func (s *LeastLoadSelector) Begin(serviceID string) {
+	s.Lock()
+	defer s.Unlock()
+	s.pending[serviceID] = append(s.pending[serviceID], time.Now())
+}
+
+func (s *LeastLoadSelector) Done(serviceID string) {
+	s.Lock()
+	defer s.Unlock()
+	if q := s.pending[serviceID]; len(q) > 0 {
+		s.pending[serviceID] = q[1:]
+	}
+}
+
+// Pending returns the number of in-flight requests of the service
+func (s *LeastLoadSelector) Pending(serviceID string) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.count(serviceID, time.Now())
+}
+
+// count drops requests pending longer than timeout, which are never
+// responded, and returns the rest
+func (s *LeastLoadSelector) count(serviceID string, now time.Time) int64 {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPendingTimeout
+	}
+	q := s.pending[serviceID]
+	i := 0
+	for i < len(q) && now.Sub(q[i]) > timeout {
+		i++
+	}
+	if i > 0 {
+		q = q[i:]
+		if len(q) == 0 {
+			delete(s.pending, serviceID)
+		} else {
+			s.pending[serviceID] = q
+		}
+	}
+	return int64(len(q))
+}
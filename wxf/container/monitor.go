@@ -0,0 +1,111 @@
+package container
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+)
+
+const (
+	MonitorPathHealth  = "/health"
+	MonitorPathReady   = "/ready"
+	MonitorPathMetrics = "/metrics"
+)
+
+// Listening is implemented by servers that can tell whether
+// they are accepting connections, such as tcp.Server and websocket.Server
+type Listening interface {
+	Listening() bool
+}
+
+type monitor struct {
+	listen string
+	mux    *http.ServeMux
+	srv    *http.Server
+}
+
+// SetMonitor serve health, readiness, metrics and other admin endpoints on listen
+func SetMonitor(listen string) {
+	c.SetMonitor(listen)
+}
+
+func (c *Container) SetMonitor(listen string) {
+	c.Lock()
+	defer c.Unlock()
+	mux := http.NewServeMux()
+	mux.HandleFunc(MonitorPathHealth, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(MonitorPathReady, func(w http.ResponseWriter, r *http.Request) {
+		if !c.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.Handle(MonitorPathMetrics, promhttp.Handler())
+	c.monitor = &monitor{listen: listen, mux: mux}
+}
+
+// HandleMonitor register an admin handler on the monitor server,
+// it does nothing if no monitor is set
+func HandleMonitor(pattern string, handler http.Handler) {
+	c.HandleMonitor(pattern, handler)
+}
+
+func (c *Container) HandleMonitor(pattern string, handler http.Handler) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.monitor == nil {
+		return
+	}
+	c.monitor.mux.Handle(pattern, handler)
+}
+
+// Ready reports whether the container is started and not draining,
+// its server is listening and every dependency has a connected client
+func (c *Container) Ready() bool {
+	if !c.alive() {
+		return false
+	}
+	c.RLock()
+	defer c.RUnlock()
+	for dep := range c.deps {
+		clients, ok := c.srvClients[dep]
+		if !ok || len(clients.Services()) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Container) startMonitor() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.monitor == nil {
+		return nil
+	}
+	lst, err := net.Listen("tcp", c.monitor.listen)
+	if err != nil {
+		return err
+	}
+	c.monitor.srv = &http.Server{Handler: c.monitor.mux}
+	go func(srv *http.Server) {
+		err := srv.Serve(lst)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorln(err)
+		}
+	}(c.monitor.srv)
+	log.Infof("monitor started on %s", lst.Addr())
+	return nil
+}
+
+func (c *Container) stopMonitor(ctx context.Context) error {
+	c.RLock()
+	defer c.RUnlock()
+	if c.monitor == nil || c.monitor.srv == nil {
+		return nil
+	}
+	return c.monitor.srv.Shutdown(ctx)
+}
@@ -1,9 +1,12 @@
 package container
 
 import (
+	"fmt"
 	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
 	"hash/crc32"
+	"strings"
 )
 
 func HashCode(key string) int {
@@ -15,3 +18,30 @@ func HashCode(key string) int {
 type Selector interface {
 	Lookup(header *pkt.Header, services []wxf.Service) string
 }
+
+// NewSelector build a selector by algorithm name, zone is only used
+// by AlgorithmZoneAware. hash based algorithms accept a key spec after
+// a colon, e.g. "hashslots:dest" or "zone:meta.room", see ParseHashKey
+func NewSelector(algorithm string, zone string) (Selector, error) {
+	name, spec, _ := strings.Cut(algorithm, ":")
+	key, err := ParseHashKey(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "", wire.AlgorithmHashSlots:
+		return &HashSelector{Key: key}, nil
+	case wire.AlgorithmWeighted, wire.AlgorithmLeastLoad:
+		if spec != "" {
+			return nil, fmt.Errorf("selector algorithm %s does not hash on a key", name)
+		}
+		if name == wire.AlgorithmWeighted {
+			return NewWeightedSelector(), nil
+		}
+		return NewLeastLoadSelector(), nil
+	case wire.AlgorithmZoneAware:
+		return NewZoneSelector(zone, &HashSelector{Key: key}), nil
+	default:
+		return nil, fmt.Errorf("unknown selector algorithm: %s", algorithm)
+	}
+}
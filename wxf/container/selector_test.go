@@ -0,0 +1,116 @@
+package container
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"testing"
+	"time"
+)
+
+func newService(id string, meta map[string]string) wxf.Service {
+	return &naming.DefaultService{Id: id, Name: "chat", Meta: meta}
+}
+
+func TestWeightedSelector(t *testing.T) {
+	services := []wxf.Service{
+		newService("s1", map[string]string{KeyServiceWeight: "3"}),
+		newService("s2", map[string]string{KeyServiceWeight: "1"}),
+		newService("s3", map[string]string{}),
+	}
+	selector := NewWeightedSelector()
+	hits := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		hits[selector.Lookup(&pkt.Header{}, services)]++
+	}
+	assert.Equal(t, 30, hits["s1"])
+	assert.Equal(t, 10, hits["s2"])
+	assert.Equal(t, 10, hits["s3"])
+}
+
+func TestLeastLoadSelector(t *testing.T) {
+	services := []wxf.Service{
+		newService("s1", nil),
+		newService("s2", nil),
+	}
+	selector := NewLeastLoadSelector()
+	assert.Equal(t, "s1", selector.Lookup(&pkt.Header{}, services))
+
+	selector.Begin("s1")
+	assert.Equal(t, "s2", selector.Lookup(&pkt.Header{}, services))
+
+	selector.Begin("s2")
+	selector.Begin("s2")
+	assert.Equal(t, "s1", selector.Lookup(&pkt.Header{}, services))
+
+	selector.Done("s2")
+	selector.Done("s2")
+	selector.Done("s2")
+	assert.Equal(t, int64(0), selector.Pending("s2"))
+	assert.Equal(t, "s2", selector.Lookup(&pkt.Header{}, services))
+
+	// requests without response expire
+	selector.Timeout = time.Millisecond * 20
+	selector.Begin("s2")
+	selector.Begin("s2")
+	assert.Equal(t, int64(2), selector.Pending("s2"))
+	time.Sleep(time.Millisecond * 30)
+	assert.Equal(t, int64(0), selector.Pending("s2"))
+	assert.Equal(t, int64(0), selector.Pending("s1"))
+}
+
+func TestZoneSelector(t *testing.T) {
+	services := []wxf.Service{
+		newService("s1", map[string]string{KeyServiceZone: "zone_a"}),
+		newService("s2", map[string]string{KeyServiceZone: "zone_b"}),
+		newService("s3", map[string]string{KeyServiceZone: "zone_b"}),
+	}
+	selector := NewZoneSelector("zone_a", nil)
+	for i := 0; i < 10; i++ {
+		header := &pkt.Header{ChannelId: string(rune('a' + i))}
+		assert.Equal(t, "s1", selector.Lookup(header, services))
+	}
+	// fallback to all services
+	selector = NewZoneSelector("zone_c", NewLeastLoadSelector())
+	assert.Equal(t, "s1", selector.Lookup(&pkt.Header{}, services))
+	selector.Begin("s1")
+	assert.Equal(t, "s2", selector.Lookup(&pkt.Header{}, services))
+}
+
+func TestNewSelector(t *testing.T) {
+	selector, err := NewSelector("", "")
+	assert.Nil(t, err)
+	assert.IsType(t, &HashSelector{}, selector)
+
+	_, err = NewSelector("unknown", "")
+	assert.NotNil(t, err)
+}
+
+func TestHashSelectorKey(t *testing.T) {
+	services := []wxf.Service{
+		newService("s1", nil),
+		newService("s2", nil),
+		newService("s3", nil),
+	}
+	selector, err := NewSelector("hashslots:dest", "")
+	assert.Nil(t, err)
+	expected := selector.Lookup(&pkt.Header{ChannelId: "c0", Dest: "group1"}, services)
+	for i := 1; i < 10; i++ {
+		header := &pkt.Header{ChannelId: fmt.Sprintf("c%d", i), Dest: "group1"}
+		assert.Equal(t, expected, selector.Lookup(header, services))
+	}
+
+	selector, err = NewSelector("zone:meta.room", "")
+	assert.Nil(t, err)
+	header := &pkt.Header{ChannelId: "c0"}
+	expected = selector.Lookup(&pkt.Header{ChannelId: "room1"}, services)
+	header.Meta = append(header.Meta, &pkt.Meta{Key: "room", Value: "room1", Type: pkt.MetaType_string})
+	assert.Equal(t, expected, selector.Lookup(header, services))
+
+	_, err = NewSelector("hashslots:unknown", "")
+	assert.NotNil(t, err)
+	_, err = NewSelector("leastload:dest", "")
+	assert.NotNil(t, err)
+}
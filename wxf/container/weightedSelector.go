@@ -0,0 +1,55 @@
+package container
+
+import (
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"strconv"
+	"sync"
+)
+
+// WeightedSelector is a smooth weighted round-robin selector,
+// weight of a service is read from meta KeyServiceWeight, default 1
+type WeightedSelector struct {
+	sync.Mutex
+	current map[string]int
+}
+
+func NewWeightedSelector() *WeightedSelector {
+	return &WeightedSelector{current: make(map[string]int)}
+}
+
+func (s *WeightedSelector) Lookup(header *pkt.Header, services []wxf.Service) string {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		total int
+		best  wxf.Service
+	)
+	alive := make(map[string]struct{}, len(services))
+	for _, srv := range services {
+		id := srv.ServiceID()
+		alive[id] = struct{}{}
+		weight := serviceWeight(srv)
+		total += weight
+		s.current[id] += weight
+		if best == nil || s.current[id] > s.current[best.ServiceID()] {
+			best = srv
+		}
+	}
+	// forget services that have gone
+	for id := range s.current {
+		if _, ok := alive[id]; !ok {
+			delete(s.current, id)
+		}
+	}
+	s.current[best.ServiceID()] -= total
+	return best.ServiceID()
+}
+
+func serviceWeight(srv wxf.Service) int {
+	weight, err := strconv.Atoi(srv.GetMeta()[KeyServiceWeight])
+	if err != nil || weight <= 0 {
+		return 1
+	}
+	return weight
+}
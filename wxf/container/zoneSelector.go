@@ -0,0 +1,46 @@
+package container
+
+import (
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+)
+
+// ZoneSelector prefers services whose meta KeyServiceZone equals Zone,
+// it falls back to all services if none of them is in the same zone.
+// the final choice is made by Next
+type ZoneSelector struct {
+	Zone string
+	Next Selector
+}
+
+func NewZoneSelector(zone string, next Selector) *ZoneSelector {
+	if next == nil {
+		next = &HashSelector{}
+	}
+	return &ZoneSelector{Zone: zone, Next: next}
+}
+
+func (s *ZoneSelector) Lookup(header *pkt.Header, services []wxf.Service) string {
+	local := make([]wxf.Service, 0, len(services))
+	for _, srv := range services {
+		if srv.GetMeta()[KeyServiceZone] == s.Zone {
+			local = append(local, srv)
+		}
+	}
+	if len(local) == 0 {
+		return s.Next.Lookup(header, services)
+	}
+	return s.Next.Lookup(header, local)
+}
+
+func (s *ZoneSelector) Begin(serviceID string) {
+	if tracker, ok := s.Next.(LoadTracker); ok {
+		tracker.Begin(serviceID)
+	}
+}
+
+func (s *ZoneSelector) Done(serviceID string) {
+	if tracker, ok := s.Next.(LoadTracker); ok {
+		tracker.Done(serviceID)
+	}
+}
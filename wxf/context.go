@@ -1,8 +1,10 @@
 package wxf
 
 import (
+	"context"
 	"github.com/golang/protobuf/proto"
 	"github.com/sirupsen/logrus"
+	"github.com/wangxuefeng90923/wxf/tracing"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
 	"sync"
 )
@@ -14,6 +16,7 @@ type Session interface {
 	GetRemoteIP() string
 	GetApp() string
 	GetTags() []string
+	GetCapabilities() *pkt.Capabilities
 }
 
 type Context interface {
@@ -22,6 +25,8 @@ type Context interface {
 	Header() *pkt.Header
 	ReadBody(val proto.Message) error
 	Session() Session
+	// App of session, its SessionStorage only reaches sessions of the App
+	App() *App
 	RespWithError(status pkt.Status, err error) error
 	Resp(status pkt.Status, body proto.Message) error
 	Dispatch(body proto.Message, recvs ...*Location) error
@@ -41,6 +46,9 @@ type ContextImpl struct {
 	index    int
 	request  *pkt.LogicPkt
 	session  Session
+	app      *App
+	// traceCtx carries the span of the request being served
+	traceCtx context.Context
 }
 
 func (c *ContextImpl) Header() *pkt.Header {
@@ -48,21 +56,27 @@ func (c *ContextImpl) Header() *pkt.Header {
 }
 
 func (c *ContextImpl) Session() Session {
-	//TODO implement me
-	panic("implement me")
+	return c.session
+}
+
+func (c *ContextImpl) App() *App {
+	return c.app
 }
 
 func (c *ContextImpl) RespWithError(status pkt.Status, err error) error {
-	//TODO implement me
-	panic("implement me")
+	return c.Resp(status, &pkt.ErrorResp{Message: err.Error()})
 }
 
 // Resp used to response a message to sender
 func (c *ContextImpl) Resp(status pkt.Status, body proto.Message) error {
 	packet := pkt.NewFrom(&c.request.Header)
 	packet.Status = status
+	// reply in the content type of request
+	packet.SetContentType(c.request.ContentType())
+	packet.SetCompression(c.Session().GetCapabilities().Compression())
 	packet.WriteBody(body)
 	packet.Flag = pkt.Flag_Response
+	tracing.Inject(c.traceCtx, &packet.Header)
 	logrus.Debugf("<-- Resp to %s command:%s  status: %v body: %s",
 		c.Session(), &c.request.Header, status, body)
 	err := c.Push(c.Session().GetGateId(), []string{c.Session().GetChannelId()}, packet)
@@ -79,9 +93,12 @@ func (c *ContextImpl) Dispatch(body proto.Message, recvs ...*Location) error {
 	if len(recvs) == 0 {
 		return nil
 	}
+	traceCtx, span := tracing.Tracer().Start(c.traceCtx, "context.dispatch")
+	defer span.End()
 	packet := pkt.NewFrom(&c.request.Header)
 	packet.Flag = pkt.Flag_Push
 	packet.WriteBody(body)
+	tracing.Inject(traceCtx, &packet.Header)
 	logrus.Debugf("<-- Dispatch to %d users command:%s",
 		len(recvs), &c.request.Header)
 
@@ -129,4 +146,6 @@ func (c *ContextImpl) reset() {
 	c.index = 0
 	c.handlers = nil
 	c.session = nil
+	c.app = nil
+	c.traceCtx = context.Background()
 }
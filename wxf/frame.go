@@ -0,0 +1,89 @@
+package wxf
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FramePreparer is optionally implemented by Conn, it encodes a frame
+// into the bytes written to the connection
+type FramePreparer interface {
+	PrepareFrame(code OpCode, payload []byte) ([]byte, error)
+}
+
+// PreparedFrame is a frame encoded once and shared by the write queues
+// of many channels, it is used to push a message to a group of channels
+type PreparedFrame struct {
+	OpCode  OpCode
+	Payload []byte
+
+	once sync.Once
+	data []byte
+	err  error
+
+	// mu guards encoded, the payloads encoded by FrameEncoders
+	mu      sync.Mutex
+	encoded map[FrameEncoder]*encodedFrame
+
+	refs    int32
+	release func()
+}
+
+func NewPreparedFrame(code OpCode, payload []byte) *PreparedFrame {
+	return &PreparedFrame{
+		OpCode:  code,
+		Payload: payload,
+	}
+}
+
+// Data returns the frame encoded by p, it is encoded only on the first
+// call, so all channels sharing a frame must be of the same protocol
+func (f *PreparedFrame) Data(p FramePreparer) ([]byte, error) {
+	f.once.Do(func() {
+		f.data, f.err = p.PrepareFrame(f.OpCode, f.Payload)
+	})
+	return f.data, f.err
+}
+
+type encodedFrame struct {
+	once    sync.Once
+	code    OpCode
+	payload []byte
+	err     error
+}
+
+// Encode returns the payload encoded by encoder, it is encoded only on
+// the first call of each encoder, so channels sharing an encoder share
+// the result as well
+func (f *PreparedFrame) Encode(encoder FrameEncoder) (OpCode, []byte, error) {
+	f.mu.Lock()
+	e, ok := f.encoded[encoder]
+	if !ok {
+		if f.encoded == nil {
+			f.encoded = make(map[FrameEncoder]*encodedFrame, 1)
+		}
+		e = new(encodedFrame)
+		f.encoded[encoder] = e
+	}
+	f.mu.Unlock()
+	e.once.Do(func() {
+		e.code, e.payload, e.err = encoder.EncodeFrame(f.Payload)
+	})
+	return e.code, e.payload, e.err
+}
+
+// SetRelease must be called before the frame is pushed, release is called
+// once the frame is released by refs users, so that its payload could be
+// put back to a pool. frames dropped without Release are left to GC
+func (f *PreparedFrame) SetRelease(refs int, release func()) {
+	f.refs = int32(refs)
+	f.release = release
+}
+
+// Release is called by a user of the frame after it is written or dropped,
+// the frame and its payload must not be used after
+func (f *PreparedFrame) Release() {
+	if f.release != nil && atomic.AddInt32(&f.refs, -1) == 0 {
+		f.release()
+	}
+}
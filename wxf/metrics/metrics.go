@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "wxf"
+
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+const (
+	HandshakeAccepted = "accepted"
+	HandshakeRejected = "rejected"
+)
+
+// ChannelTotalGauge active channels of a server
+var ChannelTotalGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Subsystem: "server",
+	Name:      "channel_total",
+	Help:      "active channels of a server",
+}, []string{"serviceId", "serviceName"})
+
+// HandshakeTotal handshakes of a server by result, accepted or rejected
+var HandshakeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "server",
+	Name:      "handshake_total",
+	Help:      "handshakes of a server by result",
+}, []string{"serviceId", "serviceName", "result"})
+
+// ChannelBytesTotal payload bytes read from or written to channels
+var ChannelBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "channel",
+	Name:      "bytes_total",
+	Help:      "payload bytes of channels by direction",
+}, []string{"direction"})
+
+// ChannelFramesTotal frames read from or written to channels
+var ChannelFramesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "channel",
+	Name:      "frames_total",
+	Help:      "frames of channels by direction",
+}, []string{"direction"})
+
+// PushDropTotal payloads dropped because the write queue of a channel is full
+var PushDropTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "channel",
+	Name:      "push_drop_total",
+	Help:      "payloads dropped by full write queues",
+})
+
+// ForwardErrorTotal errors forwarding messages to a service
+var ForwardErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "container",
+	Name:      "forward_error_total",
+	Help:      "errors forwarding messages to a service",
+}, []string{"serviceName"})
+
+// SelectorDecisionTotal services chosen by selectors
+var SelectorDecisionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "container",
+	Name:      "selector_decision_total",
+	Help:      "services chosen by selectors",
+}, []string{"serviceName", "serviceId"})
+
+// HandlerDuration latency of router handlers by command
+var HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "router",
+	Name:      "handler_duration_seconds",
+	Help:      "latency of router handlers by command",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"command"})
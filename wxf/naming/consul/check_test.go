@@ -0,0 +1,114 @@
+package consul
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// agentStub records the agent API calls of consul
+type agentStub struct {
+	sync.Mutex
+	registrations []api.AgentServiceRegistration
+	updates       []string
+}
+
+func (a *agentStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var reg api.AgentServiceRegistration
+		_ = json.NewDecoder(r.Body).Decode(&reg)
+		a.registrations = append(a.registrations, reg)
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		a.updates = append(a.updates, strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func testService() *naming.DefaultService {
+	return &naming.DefaultService{
+		Id:       "test_1",
+		Name:     "for_test",
+		Address:  "127.0.0.1",
+		Port:     8000,
+		Protocol: "ws",
+		Meta:     map[string]string{KeyHealthURL: "http://127.0.0.1:8001/health"},
+	}
+}
+
+func Test_CheckTTL(t *testing.T) {
+	stub := new(agentStub)
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ns, err := NewNamingWithOptions(srv.URL, Options{Check: CheckTTL, TTL: time.Second * 6})
+	assert.Nil(t, err)
+	err = ns.Register(testService())
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(stub.registrations))
+	check := stub.registrations[0].Check
+	assert.Equal(t, "test_1_normal", check.CheckID)
+	assert.Equal(t, "6s", check.TTL)
+	assert.Equal(t, "", check.HTTP)
+	// consul does not deregister services within a minute
+	assert.Equal(t, "1m0s", check.DeregisterCriticalServiceAfter)
+
+	hb, ok := ns.(naming.Heartbeater)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second*2, hb.HeartbeatInterval())
+	err = hb.Heartbeat("test_1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test_1_normal"}, stub.updates)
+}
+
+func Test_CheckTCP(t *testing.T) {
+	stub := new(agentStub)
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ns, err := NewNamingWithOptions(srv.URL, Options{Check: CheckTCP})
+	assert.Nil(t, err)
+	err = ns.Register(testService())
+	assert.Nil(t, err)
+
+	check := stub.registrations[0].Check
+	assert.Equal(t, "127.0.0.1:8000", check.TCP)
+	assert.Equal(t, "10s", check.Interval)
+	assert.Equal(t, "", check.HTTP)
+	assert.Equal(t, "1m0s", check.DeregisterCriticalServiceAfter)
+	assert.Equal(t, time.Duration(0), ns.(naming.Heartbeater).HeartbeatInterval())
+}
+
+func Test_CheckHTTP(t *testing.T) {
+	stub := new(agentStub)
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ns, err := NewNaming(srv.URL)
+	assert.Nil(t, err)
+	err = ns.Register(testService())
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1:8001/health", stub.registrations[0].Check.HTTP)
+
+	err = ns.Register(&naming.DefaultService{Id: "test_2", Name: "for_test"})
+	assert.Nil(t, err)
+	assert.Nil(t, stub.registrations[1].Check)
+
+	ns, _ = NewNamingWithOptions(srv.URL, Options{Interval: time.Second * 45})
+	_ = ns.Register(testService())
+	assert.Equal(t, "1m30s", stub.registrations[2].Check.DeregisterCriticalServiceAfter)
+
+	ns, _ = NewNamingWithOptions(srv.URL, Options{Check: "unknown"})
+	assert.NotNil(t, ns.Register(testService()))
+}
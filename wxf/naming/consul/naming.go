@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/hashicorp/consul/api"
@@ -14,19 +15,69 @@ import (
 const (
 	KeyProtocol  = "protocol"
 	KeyHealthURL = "health_url"
+	KeyNamespace = "namespace"
 )
 
+// health check of registered services
+const (
+	// CheckHTTP is used by default if meta KeyHealthURL is present
+	CheckHTTP = "http"
+	// CheckTTL requires the service to heartbeat before TTL expires
+	CheckTTL = "ttl"
+	// CheckTCP dials the public address of the service
+	CheckTCP = "tcp"
+)
+
+const (
+	DefaultCheckTTL      = time.Second * 15
+	DefaultCheckInterval = time.Second * 10
+	DefaultWaitTime      = time.Minute * 5
+	DefaultRetryInterval = time.Second
+	DefaultMaxRetry      = time.Second * 30
+	// MinDeregisterAfter is the minimum of DeregisterCriticalServiceAfter
+	// enforced by consul
+	MinDeregisterAfter = time.Minute
+)
+
+type Options struct {
+	// Check is one of CheckHTTP, CheckTTL and CheckTCP, the HTTP check is
+	// used if it is empty and meta KeyHealthURL is present
+	Check string
+	// TTL of CheckTTL, DefaultCheckTTL if 0
+	TTL time.Duration
+	// Interval of CheckHTTP and CheckTCP, DefaultCheckInterval if 0
+	Interval time.Duration
+	// WaitTime of blocking queries in watches, DefaultWaitTime if 0
+	WaitTime time.Duration
+	// RetryInterval is the first backoff of a failed watch, it is doubled
+	// on each failure up to MaxRetry
+	RetryInterval time.Duration
+	MaxRetry      time.Duration
+	// IncludeCritical finds services failing health checks too, only
+	// passing services are found by default
+	IncludeCritical bool
+}
+
+// Filter of services watched by SubscribeWithFilter
+type Filter struct {
+	Namespace string
+	Tags      []string
+}
+
 type Watch struct {
 	Service   string
+	Filter    Filter
 	Callback  func([]wxf.ServiceRegistration)
 	WaitIndex uint64
-	Quit      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
 type Naming struct {
 	sync.RWMutex
 	cli     *api.Client
 	watches map[string]*Watch
+	options Options
 }
 
 func (n *Naming) Find(serviceName string, tags ...string) ([]wxf.ServiceRegistration, error) {
@@ -38,15 +89,24 @@ func (n *Naming) Find(serviceName string, tags ...string) ([]wxf.ServiceRegistra
 }
 
 func (n *Naming) Subscribe(serviceName string, callback func([]wxf.ServiceRegistration)) error {
+	return n.SubscribeWithFilter(serviceName, Filter{}, callback)
+}
+
+// SubscribeWithFilter watches services of serviceName in filter.Namespace
+// which have all of filter.Tags
+func (n *Naming) SubscribeWithFilter(serviceName string, filter Filter, callback func([]wxf.ServiceRegistration)) error {
 	n.Lock()
 	defer n.Unlock()
 	if _, ok := n.watches[serviceName]; ok {
 		return errors.New("serviceName has already been registered")
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	w := &Watch{
 		Service:  serviceName,
+		Filter:   filter,
 		Callback: callback,
-		Quit:     make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 	n.watches[serviceName] = w
 
@@ -61,7 +121,7 @@ func (n *Naming) Unsubscribe(serviceName string) error {
 	delete(n.watches, serviceName)
 
 	if ok {
-		close(wh.Quit)
+		wh.cancel()
 	}
 	return nil
 }
@@ -79,17 +139,45 @@ func (n *Naming) Register(s wxf.ServiceRegistration) error {
 		reg.Meta = make(map[string]string)
 	}
 	reg.Meta[KeyProtocol] = s.GetProtocol()
+	if s.GetNamespace() != "" {
+		reg.Meta[KeyNamespace] = s.GetNamespace()
+	}
 
 	// consul health check
 	healthURL := s.GetMeta()[KeyHealthURL]
-	if healthURL != "" {
+	checkType := n.options.Check
+	if checkType == "" && healthURL != "" {
+		checkType = CheckHTTP
+	}
+	switch checkType {
+	case "":
+	case CheckHTTP:
+		if healthURL == "" {
+			return fmt.Errorf("meta %s is required by http check", KeyHealthURL)
+		}
 		check := new(api.AgentServiceCheck)
-		check.CheckID = fmt.Sprintf("%s_normal", s.ServiceID())
+		check.CheckID = checkID(s.ServiceID())
 		check.HTTP = healthURL
 		check.Timeout = "1s"
-		check.Interval = "10s"
-		check.DeregisterCriticalServiceAfter = "20s"
+		check.Interval = n.options.Interval.String()
+		check.DeregisterCriticalServiceAfter = deregisterAfter(n.options.Interval)
+		reg.Check = check
+	case CheckTCP:
+		check := new(api.AgentServiceCheck)
+		check.CheckID = checkID(s.ServiceID())
+		check.TCP = fmt.Sprintf("%s:%d", s.PublicAddress(), s.PublicPort())
+		check.Timeout = "1s"
+		check.Interval = n.options.Interval.String()
+		check.DeregisterCriticalServiceAfter = deregisterAfter(n.options.Interval)
 		reg.Check = check
+	case CheckTTL:
+		check := new(api.AgentServiceCheck)
+		check.CheckID = checkID(s.ServiceID())
+		check.TTL = n.options.TTL.String()
+		check.DeregisterCriticalServiceAfter = deregisterAfter(n.options.TTL)
+		reg.Check = check
+	default:
+		return fmt.Errorf("unknown health check: %s", checkType)
 	}
 
 	err := n.cli.Agent().ServiceRegister(reg)
@@ -100,7 +188,52 @@ func (n *Naming) Deregister(serviceID string) error {
 	return n.cli.Agent().ServiceDeregister(serviceID)
 }
 
+// Heartbeat passes the TTL check of serviceID
+func (n *Naming) Heartbeat(serviceID string) error {
+	return n.cli.Agent().UpdateTTL(checkID(serviceID), "", api.HealthPassing)
+}
+
+// HeartbeatInterval returns a third of TTL if CheckTTL is used, or 0
+func (n *Naming) HeartbeatInterval() time.Duration {
+	if n.options.Check != CheckTTL {
+		return 0
+	}
+	return n.options.TTL / 3
+}
+
+// deregisterAfter is twice of the check period d, but not less than
+// MinDeregisterAfter as consul does not deregister services earlier
+func deregisterAfter(d time.Duration) string {
+	if d*2 < MinDeregisterAfter {
+		return MinDeregisterAfter.String()
+	}
+	return (d * 2).String()
+}
+
+func checkID(serviceID string) string {
+	return fmt.Sprintf("%s_normal", serviceID)
+}
+
 func NewNaming(consulUrl string) (naming.Naming, error) {
+	return NewNamingWithOptions(consulUrl, Options{})
+}
+
+func NewNamingWithOptions(consulUrl string, opts Options) (naming.Naming, error) {
+	if opts.TTL == 0 {
+		opts.TTL = DefaultCheckTTL
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultCheckInterval
+	}
+	if opts.WaitTime == 0 {
+		opts.WaitTime = DefaultWaitTime
+	}
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.MaxRetry == 0 {
+		opts.MaxRetry = DefaultMaxRetry
+	}
 	conf := api.DefaultConfig()
 	conf.Address = consulUrl
 	cli, err := api.NewClient(conf)
@@ -110,6 +243,7 @@ func NewNaming(consulUrl string) (naming.Naming, error) {
 	return &Naming{
 		cli:     cli,
 		watches: make(map[string]*Watch, 1),
+		options: opts,
 	}, nil
 }
 
@@ -119,53 +253,85 @@ func (n *Naming) load(name string, waitIndex uint64, tags ...string) ([]wxf.Serv
 		MaxAge:    time.Minute,
 		WaitIndex: waitIndex,
 	}
-	catalogServices, meta, err := n.cli.Catalog().ServiceMultipleTags(name, tags, opts)
+	return n.query(name, tags, opts)
+}
+
+func (n *Naming) query(name string, tags []string, opts *api.QueryOptions) ([]wxf.ServiceRegistration, *api.QueryMeta, error) {
+	entries, meta, err := n.cli.Health().ServiceMultipleTags(name, tags, !n.options.IncludeCritical, opts)
 	if err != nil {
 		return nil, meta, err
 	}
-	services := make([]wxf.ServiceRegistration, 0, len(catalogServices))
-	for _, s := range catalogServices {
-		if s.Checks.AggregatedStatus() != api.HealthPassing {
-			logrus.Debugf("load service: id:%s name:%s %s:%d Status:%s",
-				s.ServiceID, s.ServiceName, s.ServiceAddress, s.ServicePort, s.Checks.AggregatedStatus())
-			continue
+	services := make([]wxf.ServiceRegistration, 0, len(entries))
+	for _, e := range entries {
+		s := e.Service
+		address := s.Address
+		if address == "" && e.Node != nil {
+			address = e.Node.Address
 		}
 		services = append(services, &naming.DefaultService{
-			Id:       s.ServiceID,
-			Name:     s.ServiceName,
-			Address:  s.ServiceAddress,
-			Port:     s.ServicePort,
-			Protocol: s.ServiceMeta[KeyProtocol],
-			Tags:     s.ServiceTags,
-			Meta:     s.ServiceMeta,
+			Id:        s.ID,
+			Name:      s.Service,
+			Namespace: s.Meta[KeyNamespace],
+			Address:   address,
+			Port:      s.Port,
+			Protocol:  s.Meta[KeyProtocol],
+			Tags:      s.Tags,
+			Meta:      s.Meta,
 		})
 	}
 	logrus.Debugf("load services: %v, meta: %v", services, meta)
 	return services, meta, nil
 }
 
+// watch runs blocking queries until the watch is unsubscribed. The first
+// result is taken as the baseline and is not notified, as the subscriber
+// finds existing services by itself, unless it is late because of errors.
 func (n *Naming) watch(wh *Watch) {
-	stopped := false
-	doWatch := func(service string, callback func([]wxf.ServiceRegistration)) {
-		services, meta, err := n.load(service, wh.WaitIndex)
-		if err != nil {
-			logrus.Warn(err)
-			return
-		}
-		select {
-		case <-wh.Quit:
-			stopped = true
+	opts := &api.QueryOptions{
+		WaitTime: n.options.WaitTime,
+	}
+	if wh.Filter.Namespace != "" {
+		opts.Filter = fmt.Sprintf("Service.Meta.%s == %q", KeyNamespace, wh.Filter.Namespace)
+	}
+	opts = opts.WithContext(wh.ctx)
+
+	retry := time.Duration(0)
+	notify := false
+	for {
+		opts.WaitIndex = wh.WaitIndex
+		services, meta, err := n.query(wh.Service, wh.Filter.Tags, opts)
+		if wh.ctx.Err() != nil {
 			logrus.Infof("watch %s stopped", wh.Service)
 			return
-		default:
+		}
+		if err != nil {
+			if retry == 0 {
+				retry = n.options.RetryInterval
+			} else if retry *= 2; retry > n.options.MaxRetry {
+				retry = n.options.MaxRetry
+			}
+			logrus.Warnf("watch %s failed, retry in %v: %v", wh.Service, retry, err)
+			notify = true
+			select {
+			case <-wh.ctx.Done():
+				logrus.Infof("watch %s stopped", wh.Service)
+				return
+			case <-time.After(retry):
+			}
+			continue
+		}
+		retry = 0
+		if wh.WaitIndex != 0 && meta.LastIndex != wh.WaitIndex {
+			notify = true
 		}
 		wh.WaitIndex = meta.LastIndex
-		if callback != nil {
-			callback(services)
+		// the index may go backwards, e.g. consul servers restarted
+		if meta.LastIndex < opts.WaitIndex {
+			wh.WaitIndex = 0
 		}
-	}
-	doWatch(wh.Service, nil)
-	for !stopped {
-		doWatch(wh.Service, wh.Callback)
+		if notify && wh.Callback != nil {
+			wh.Callback(services)
+		}
+		notify = false
 	}
 }
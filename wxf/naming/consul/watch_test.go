@@ -0,0 +1,232 @@
+package consul
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// healthStub serves blocking queries of /v1/health/service/
+type healthStub struct {
+	sync.Mutex
+	index    uint64
+	services []*api.ServiceEntry
+	critical map[string]bool
+	changed  chan struct{}
+	fails    int
+	queries  []url.Values
+	canceled int
+}
+
+func newHealthStub() *healthStub {
+	return &healthStub{index: 1, changed: make(chan struct{})}
+}
+
+func (c *healthStub) set(ids ...string) {
+	c.Lock()
+	defer c.Unlock()
+	c.services = c.services[:0]
+	for _, id := range ids {
+		status := api.HealthPassing
+		if c.critical[id] {
+			status = api.HealthCritical
+		}
+		c.services = append(c.services, &api.ServiceEntry{
+			Node: &api.Node{Address: "127.0.0.1"},
+			Service: &api.AgentService{
+				ID:      id,
+				Service: "chat",
+				Meta:    map[string]string{KeyProtocol: "tcp"},
+			},
+			Checks: api.HealthChecks{{ServiceID: id, Status: status}},
+		})
+	}
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *healthStub) stats() (queries int, canceled int) {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.queries), c.canceled
+}
+
+func (c *healthStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	c.Lock()
+	c.queries = append(c.queries, q)
+	if c.fails > 0 {
+		c.fails--
+		c.Unlock()
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	index, _ := strconv.ParseUint(q.Get("index"), 10, 64)
+	wait, _ := time.ParseDuration(q.Get("wait"))
+	changed := c.changed
+	if index >= c.index {
+		c.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			c.Lock()
+			c.canceled++
+			c.Unlock()
+			return
+		}
+		c.Lock()
+	}
+	services := c.services
+	if _, ok := q["passing"]; ok {
+		services = make([]*api.ServiceEntry, 0, len(c.services))
+		for _, e := range c.services {
+			if e.Checks.AggregatedStatus() == api.HealthPassing {
+				services = append(services, e)
+			}
+		}
+	}
+	body, _ := json.Marshal(services)
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	c.Unlock()
+	_, _ = w.Write(body)
+}
+
+func Test_Watch(t *testing.T) {
+	stub := newHealthStub()
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ns, err := NewNamingWithOptions(srv.URL, Options{WaitTime: time.Millisecond * 200})
+	assert.Nil(t, err)
+
+	notified := make(chan []wxf.ServiceRegistration, 10)
+	err = ns.Subscribe("chat", func(services []wxf.ServiceRegistration) {
+		notified <- services
+	})
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 100)
+
+	stub.set("chat01")
+	select {
+	case services := <-notified:
+		assert.Equal(t, 1, len(services))
+		assert.Equal(t, "chat01", services[0].ServiceID())
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriber is not notified")
+	}
+	// blocking queries time out without changes
+	select {
+	case <-notified:
+		t.Fatal("subscriber is notified without changes")
+	case <-time.After(time.Millisecond * 500):
+	}
+	queries, _ := stub.stats()
+	assert.Less(t, queries, 10)
+	stub.Lock()
+	assert.Equal(t, "200ms", stub.queries[0].Get("wait"))
+	stub.Unlock()
+
+	// unsubscribe while a long poll is outstanding
+	_ = ns.Unsubscribe("chat")
+	assert.Eventually(t, func() bool {
+		_, canceled := stub.stats()
+		return canceled == 1
+	}, time.Second*5, time.Millisecond*10)
+	stub.set("chat01", "chat02")
+	select {
+	case <-notified:
+		t.Fatal("subscriber is notified after unsubscribe")
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func Test_WatchBackoff(t *testing.T) {
+	stub := newHealthStub()
+	stub.fails = 3
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ns, err := NewNamingWithOptions(srv.URL, Options{
+		WaitTime:      time.Second,
+		RetryInterval: time.Millisecond * 50,
+		MaxRetry:      time.Millisecond * 100,
+	})
+	assert.Nil(t, err)
+
+	notified := make(chan []wxf.ServiceRegistration, 10)
+	start := time.Now()
+	err = ns.Subscribe("chat", func(services []wxf.ServiceRegistration) {
+		notified <- services
+	})
+	assert.Nil(t, err)
+
+	// the first result is notified as it is late
+	select {
+	case <-notified:
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriber is not notified")
+	}
+	// 50ms + 100ms + 100ms
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*250)
+	queries, _ := stub.stats()
+	assert.Equal(t, 4, queries)
+	_ = ns.Unsubscribe("chat")
+}
+
+func Test_WatchFilter(t *testing.T) {
+	stub := newHealthStub()
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ns, err := NewNamingWithOptions(srv.URL, Options{WaitTime: time.Second})
+	assert.Nil(t, err)
+
+	err = ns.(*Naming).SubscribeWithFilter("chat", Filter{
+		Namespace: "im",
+		Tags:      []string{"gate", "zone_a"},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		queries, _ := stub.stats()
+		return queries > 0
+	}, time.Second*5, time.Millisecond*10)
+
+	stub.Lock()
+	q := stub.queries[0]
+	stub.Unlock()
+	assert.Equal(t, []string{"gate", "zone_a"}, q["tag"])
+	assert.Equal(t, `Service.Meta.namespace == "im"`, q.Get("filter"))
+	_ = ns.Unsubscribe("chat")
+}
+
+func Test_WatchPassing(t *testing.T) {
+	stub := newHealthStub()
+	stub.critical = map[string]bool{"chat02": true}
+	stub.set("chat01", "chat02")
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	// services failing health checks are not found by default
+	ns, err := NewNamingWithOptions(srv.URL, Options{WaitTime: time.Second})
+	assert.Nil(t, err)
+	services, err := ns.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(services))
+	assert.Equal(t, "chat01", services[0].ServiceID())
+	assert.Equal(t, "127.0.0.1", services[0].PublicAddress())
+
+	ns, _ = NewNamingWithOptions(srv.URL, Options{WaitTime: time.Second, IncludeCritical: true})
+	services, err = ns.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(services))
+}
@@ -0,0 +1,244 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keys of TXT records of a service instance, others are put into meta
+const (
+	KeyID        = "id"
+	KeyProtocol  = "protocol"
+	KeyNamespace = "namespace"
+	KeyTags      = "tags"
+)
+
+const (
+	DefaultInterval = time.Second * 10
+	DefaultTimeout  = time.Second * 5
+)
+
+var log = logrus.WithField("module", "naming.dns")
+
+type Options struct {
+	// Domain the services belong to, a service is resolved by
+	// the SRV record _<serviceName>._tcp.<Domain>
+	Domain string
+	// Interval of polling subscribed services, DefaultInterval if 0
+	Interval time.Duration
+	// Timeout of a lookup, DefaultTimeout if 0
+	Timeout time.Duration
+	// Resolver net.DefaultResolver if nil
+	Resolver *net.Resolver
+}
+
+type Watch struct {
+	Service  string
+	Callback func([]wxf.ServiceRegistration)
+	Quit     chan struct{}
+}
+
+// Naming is a read-only naming.Naming resolving services by DNS.
+// each target of the SRV record of a service is an instance, whose
+// id, protocol, namespace, tags and meta are read from TXT records
+// of the target, one key=value per record, for example
+//
+//	_chat._tcp.wxf.local. SRV 0 0 8005 chat01.wxf.local.
+//	chat01.wxf.local.     TXT "id=chat01"
+//	chat01.wxf.local.     TXT "protocol=tcp"
+//	chat01.wxf.local.     TXT "tags=a,b"
+//	chat01.wxf.local.     TXT "zone=zone_a"
+type Naming struct {
+	sync.RWMutex
+	options Options
+	watches map[string]*Watch
+}
+
+func NewNaming(opts Options) (*Naming, error) {
+	if opts.Domain == "" {
+		return nil, errors.New("domain is required")
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	return &Naming{
+		options: opts,
+		watches: make(map[string]*Watch, 1),
+	}, nil
+}
+
+func (n *Naming) Find(serviceName string, tags ...string) ([]wxf.ServiceRegistration, error) {
+	services, err := n.load(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]wxf.ServiceRegistration, 0, len(services))
+	for _, s := range services {
+		if s.HasTags(tags...) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (n *Naming) Subscribe(serviceName string, callback func([]wxf.ServiceRegistration)) error {
+	n.Lock()
+	defer n.Unlock()
+	if _, ok := n.watches[serviceName]; ok {
+		return errors.New("serviceName has already been registered")
+	}
+	w := &Watch{
+		Service:  serviceName,
+		Callback: callback,
+		Quit:     make(chan struct{}),
+	}
+	n.watches[serviceName] = w
+
+	go n.watch(w)
+	return nil
+}
+
+func (n *Naming) Unsubscribe(serviceName string) error {
+	n.Lock()
+	defer n.Unlock()
+	wh, ok := n.watches[serviceName]
+	delete(n.watches, serviceName)
+
+	if ok {
+		close(wh.Quit)
+	}
+	return nil
+}
+
+// Register is not supported, services are published by DNS records
+func (n *Naming) Register(wxf.ServiceRegistration) error {
+	return naming.ErrNotSupported
+}
+
+// Deregister is not supported, services are published by DNS records
+func (n *Naming) Deregister(string) error {
+	return naming.ErrNotSupported
+}
+
+func (n *Naming) watch(wh *Watch) {
+	// the first result is not notified, as Consul does
+	last := ""
+	if services, err := n.load(wh.Service); err == nil {
+		last = fingerprint(services)
+	} else {
+		log.Warn(err)
+	}
+	ticker := time.NewTicker(n.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-wh.Quit:
+			log.Infof("watch %s stopped", wh.Service)
+			return
+		case <-ticker.C:
+		}
+		services, err := n.load(wh.Service)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+		// unsubscribed while loading
+		select {
+		case <-wh.Quit:
+			log.Infof("watch %s stopped", wh.Service)
+			return
+		default:
+		}
+		fp := fingerprint(services)
+		if fp == last {
+			continue
+		}
+		last = fp
+		if wh.Callback != nil {
+			list := make([]wxf.ServiceRegistration, len(services))
+			for i, s := range services {
+				list[i] = s
+			}
+			wh.Callback(list)
+		}
+	}
+}
+
+func (n *Naming) load(serviceName string) ([]*naming.DefaultService, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.options.Timeout)
+	defer cancel()
+	_, srvs, err := n.options.Resolver.LookupSRV(ctx, serviceName, "tcp", n.options.Domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return []*naming.DefaultService{}, nil
+		}
+		return nil, err
+	}
+	services := make([]*naming.DefaultService, 0, len(srvs))
+	for _, srv := range srvs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		txts, err := n.options.Resolver.LookupTXT(ctx, srv.Target)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				return nil, err
+			}
+		}
+		s := &naming.DefaultService{
+			Id:      fmt.Sprintf("%s_%d", target, srv.Port),
+			Name:    serviceName,
+			Address: target,
+			Port:    int(srv.Port),
+			Meta:    make(map[string]string),
+		}
+		for _, txt := range txts {
+			key, value, ok := strings.Cut(txt, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case KeyID:
+				s.Id = value
+			case KeyProtocol:
+				s.Protocol = value
+			case KeyNamespace:
+				s.Namespace = value
+			case KeyTags:
+				s.Tags = strings.Split(value, ",")
+			default:
+				s.Meta[key] = value
+			}
+		}
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Id < services[j].Id
+	})
+	return services, nil
+}
+
+func fingerprint(services []*naming.DefaultService) string {
+	var sb strings.Builder
+	for _, s := range services {
+		sb.WriteString(s.String())
+		sb.WriteString(s.Protocol)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
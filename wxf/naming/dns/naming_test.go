@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"context"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// zone is an in-process DNS server serving SRV and TXT records
+type zone struct {
+	sync.RWMutex
+	records map[string][]dns.RR
+}
+
+func (z *zone) set(records ...string) {
+	z.Lock()
+	defer z.Unlock()
+	z.records = make(map[string][]dns.RR)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			panic(err)
+		}
+		key := dns.Fqdn(rr.Header().Name) + dns.TypeToString[rr.Header().Rrtype]
+		z.records[key] = append(z.records[key], rr)
+	}
+}
+
+func (z *zone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	z.RLock()
+	defer z.RUnlock()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	for _, q := range r.Question {
+		m.Answer = append(m.Answer, z.records[q.Name+dns.TypeToString[q.Qtype]]...)
+	}
+	if len(m.Answer) == 0 {
+		m.Rcode = dns.RcodeNameError
+	}
+	_ = w.WriteMsg(m)
+}
+
+func startZone(t *testing.T) (*zone, *net.Resolver) {
+	z := &zone{}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &dns.Server{PacketConn: pc, Handler: z}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", pc.LocalAddr().String())
+		},
+	}
+	return z, resolver
+}
+
+func Test_Naming(t *testing.T) {
+	z, resolver := startZone(t)
+	z.set(
+		"_chat._tcp.wxf.local. 1 IN SRV 0 0 8005 chat01.wxf.local.",
+		"chat01.wxf.local. 1 IN TXT id=chat01",
+		"chat01.wxf.local. 1 IN TXT protocol=tcp",
+		"chat01.wxf.local. 1 IN TXT tags=chat,gate",
+		"chat01.wxf.local. 1 IN TXT zone=zone_a",
+	)
+
+	ns, err := NewNaming(Options{
+		Domain:   "wxf.local",
+		Interval: time.Millisecond * 50,
+		Resolver: resolver,
+	})
+	assert.Nil(t, err)
+
+	servs, err := ns.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(servs))
+	assert.Equal(t, "chat01", servs[0].ServiceID())
+	assert.Equal(t, "tcp", servs[0].GetProtocol())
+	assert.Equal(t, "chat01.wxf.local:8005", servs[0].DialURL())
+	assert.Equal(t, []string{"chat", "gate"}, servs[0].GetTags())
+	assert.Equal(t, "zone_a", servs[0].GetMeta()["zone"])
+
+	servs, err = ns.Find("chat", "canary")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(servs))
+
+	// unknown service
+	servs, err = ns.Find("unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(servs))
+
+	assert.Equal(t, naming.ErrNotSupported, ns.Register(&naming.DefaultService{Id: "chat03"}))
+	assert.Equal(t, naming.ErrNotSupported, ns.Deregister("chat01"))
+
+	notified := make(chan []wxf.ServiceRegistration, 10)
+	err = ns.Subscribe("chat", func(services []wxf.ServiceRegistration) {
+		notified <- services
+	})
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+
+	z.set(
+		"_chat._tcp.wxf.local. 1 IN SRV 0 0 8005 chat01.wxf.local.",
+		"_chat._tcp.wxf.local. 1 IN SRV 0 0 8005 chat02.wxf.local.",
+		"chat01.wxf.local. 1 IN TXT id=chat01",
+		"chat01.wxf.local. 1 IN TXT protocol=tcp",
+		"chat01.wxf.local. 1 IN TXT tags=chat,gate",
+		"chat01.wxf.local. 1 IN TXT zone=zone_a",
+		"chat02.wxf.local. 1 IN TXT id=chat02",
+		"chat02.wxf.local. 1 IN TXT protocol=tcp",
+	)
+	select {
+	case services := <-notified:
+		assert.Equal(t, 2, len(services))
+		assert.Equal(t, "chat02", services[1].ServiceID())
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriber is not notified")
+	}
+	// nothing changed
+	select {
+	case <-notified:
+		t.Fatal("subscriber is notified without changes")
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	_ = ns.Unsubscribe("chat")
+	z.set()
+	select {
+	case <-notified:
+		t.Fatal("subscriber is notified after unsubscribe")
+	case <-time.After(time.Millisecond * 200):
+	}
+}
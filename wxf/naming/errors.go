@@ -0,0 +1,7 @@
+package naming
+
+import "errors"
+
+// ErrNotSupported is returned by read-only naming implementations
+// on Register and Deregister
+var ErrNotSupported = errors.New("operation is not supported by this naming")
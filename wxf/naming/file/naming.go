@@ -0,0 +1,267 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var log = logrus.WithField("module", "naming.file")
+
+// Service is an entry of the services file
+type Service struct {
+	ID        string            `json:"id" yaml:"id"`
+	Name      string            `json:"name" yaml:"name"`
+	Address   string            `json:"address" yaml:"address"`
+	Port      int               `json:"port" yaml:"port"`
+	Protocol  string            `json:"protocol" yaml:"protocol"`
+	Namespace string            `json:"namespace" yaml:"namespace"`
+	Tags      []string          `json:"tags" yaml:"tags"`
+	Meta      map[string]string `json:"meta" yaml:"meta"`
+}
+
+// Services is the content of a services file, for example
+//
+//	services:
+//	  - id: chat01
+//	    name: chat
+//	    address: 10.0.0.1
+//	    port: 8005
+//	    protocol: tcp
+//	    tags: [chat]
+//	    meta: {zone: zone_a}
+type Services struct {
+	Services []Service `json:"services" yaml:"services"`
+}
+
+type Watch struct {
+	Service  string
+	Callback func([]wxf.ServiceRegistration)
+	notify   chan struct{}
+	Quit     chan struct{}
+}
+
+// Naming is a read-only naming.Naming backed by a YAML or JSON file,
+// the file is reloaded once it is changed and subscribers of the
+// services changed are notified with the new set. the file should be
+// replaced atomically(write to a temp file and rename it), otherwise
+// subscribers may see a partially written file
+type Naming struct {
+	sync.RWMutex
+	path     string
+	services map[string][]*naming.DefaultService
+	watches  map[string]*Watch
+	watcher  *fsnotify.Watcher
+}
+
+func NewNaming(path string) (*Naming, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	services, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch the directory, editors often replace the file instead of writing it
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	n := &Naming{
+		path:     path,
+		services: services,
+		watches:  make(map[string]*Watch, 1),
+		watcher:  watcher,
+	}
+	go n.watchFile()
+	return n, nil
+}
+
+func (n *Naming) Find(serviceName string, tags ...string) ([]wxf.ServiceRegistration, error) {
+	n.RLock()
+	defer n.RUnlock()
+	services := make([]wxf.ServiceRegistration, 0)
+	for _, s := range n.services[serviceName] {
+		if !s.HasTags(tags...) {
+			continue
+		}
+		services = append(services, s.Clone())
+	}
+	return services, nil
+}
+
+func (n *Naming) Subscribe(serviceName string, callback func([]wxf.ServiceRegistration)) error {
+	n.Lock()
+	defer n.Unlock()
+	if _, ok := n.watches[serviceName]; ok {
+		return errors.New("serviceName has already been registered")
+	}
+	w := &Watch{
+		Service:  serviceName,
+		Callback: callback,
+		notify:   make(chan struct{}, 1),
+		Quit:     make(chan struct{}),
+	}
+	n.watches[serviceName] = w
+
+	go n.watch(w)
+	return nil
+}
+
+func (n *Naming) Unsubscribe(serviceName string) error {
+	n.Lock()
+	defer n.Unlock()
+	wh, ok := n.watches[serviceName]
+	delete(n.watches, serviceName)
+
+	if ok {
+		close(wh.Quit)
+	}
+	return nil
+}
+
+// Register is not supported, services are only listed in the file
+func (n *Naming) Register(wxf.ServiceRegistration) error {
+	return naming.ErrNotSupported
+}
+
+// Deregister is not supported, services are only listed in the file
+func (n *Naming) Deregister(string) error {
+	return naming.ErrNotSupported
+}
+
+// Close stops watching the file and all of the subscriptions
+func (n *Naming) Close() error {
+	n.Lock()
+	for name, wh := range n.watches {
+		close(wh.Quit)
+		delete(n.watches, name)
+	}
+	n.Unlock()
+	return n.watcher.Close()
+}
+
+// Reload loads the file and notify subscribers of services changed,
+// it is called automatically when the file is changed
+func (n *Naming) Reload() error {
+	services, err := load(n.path)
+	if err != nil {
+		return err
+	}
+	n.Lock()
+	defer n.Unlock()
+	old := n.services
+	n.services = services
+	for name, wh := range n.watches {
+		if fingerprint(old[name]) == fingerprint(services[name]) {
+			continue
+		}
+		select {
+		case wh.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (n *Naming) watchFile() {
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != n.path {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			if err := n.Reload(); err != nil {
+				log.Warn(err)
+			}
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warn(err)
+		}
+	}
+}
+
+func (n *Naming) watch(wh *Watch) {
+	for {
+		select {
+		case <-wh.Quit:
+			return
+		case <-wh.notify:
+			services, _ := n.Find(wh.Service)
+			if wh.Callback != nil {
+				wh.Callback(services)
+			}
+		}
+	}
+}
+
+func load(path string) (map[string][]*naming.DefaultService, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var content Services
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(bts, &content)
+	} else {
+		err = yaml.Unmarshal(bts, &content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	services := make(map[string][]*naming.DefaultService)
+	for _, s := range content.Services {
+		if s.ID == "" || s.Name == "" {
+			return nil, fmt.Errorf("parse %s: id and name of service are required", path)
+		}
+		services[s.Name] = append(services[s.Name], &naming.DefaultService{
+			Id:        s.ID,
+			Name:      s.Name,
+			Address:   s.Address,
+			Port:      s.Port,
+			Protocol:  s.Protocol,
+			Namespace: s.Namespace,
+			Tags:      s.Tags,
+			Meta:      s.Meta,
+		})
+	}
+	for _, list := range services {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Id < list[j].Id
+		})
+	}
+	return services, nil
+}
+
+func fingerprint(services []*naming.DefaultService) string {
+	var sb strings.Builder
+	for _, s := range services {
+		sb.WriteString(s.String())
+		sb.WriteString(s.Protocol)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,152 @@
+package file
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const servicesV1 = `
+services:
+  - id: chat01
+    name: chat
+    address: 127.0.0.1
+    port: 8005
+    protocol: tcp
+    tags: [chat]
+    meta: {zone: zone_a}
+  - id: gateway01
+    name: wgateway
+    address: 127.0.0.1
+    port: 8000
+    protocol: ws
+`
+
+const servicesV2 = `
+services:
+  - id: chat01
+    name: chat
+    address: 127.0.0.1
+    port: 8005
+    protocol: tcp
+    tags: [chat]
+    meta: {zone: zone_a}
+  - id: chat02
+    name: chat
+    address: 127.0.0.1
+    port: 8015
+    protocol: tcp
+    tags: [chat, canary]
+  - id: gateway01
+    name: wgateway
+    address: 127.0.0.1
+    port: 8000
+    protocol: ws
+`
+
+func Test_Naming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(servicesV1), 0644))
+
+	ns, err := NewNaming(path)
+	assert.Nil(t, err)
+	defer ns.Close()
+
+	servs, err := ns.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(servs))
+	assert.Equal(t, "127.0.0.1:8005", servs[0].DialURL())
+	assert.Equal(t, "zone_a", servs[0].GetMeta()["zone"])
+
+	assert.Equal(t, naming.ErrNotSupported, ns.Register(servs[0]))
+	assert.Equal(t, naming.ErrNotSupported, ns.Deregister("chat01"))
+
+	notified := make(chan []wxf.ServiceRegistration, 10)
+	err = ns.Subscribe("chat", func(services []wxf.ServiceRegistration) {
+		notified <- services
+	})
+	assert.Nil(t, err)
+	gatewayNotified := make(chan []wxf.ServiceRegistration, 10)
+	_ = ns.Subscribe("wgateway", func(services []wxf.ServiceRegistration) {
+		gatewayNotified <- services
+	})
+
+	assert.Nil(t, writeFile(path, servicesV2))
+	select {
+	case services := <-notified:
+		assert.Equal(t, 2, len(services))
+		assert.Equal(t, "chat02", services[1].ServiceID())
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriber is not notified")
+	}
+	// wgateway is not changed
+	select {
+	case <-gatewayNotified:
+		t.Fatal("subscriber of wgateway is notified")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	servs, _ = ns.Find("chat", "canary")
+	assert.Equal(t, 1, len(servs))
+	assert.Equal(t, "chat02", servs[0].ServiceID())
+
+	// a broken file is ignored
+	assert.Nil(t, writeFile(path, "services: ["))
+	time.Sleep(time.Millisecond * 100)
+	servs, _ = ns.Find("chat")
+	assert.Equal(t, 2, len(servs))
+}
+
+func TestJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.json")
+	content := `{"services":[{"id":"chat01","name":"chat","address":"127.0.0.1","port":8005,"protocol":"tcp"}]}`
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+
+	ns, err := NewNaming(path)
+	assert.Nil(t, err)
+	defer ns.Close()
+
+	servs, err := ns.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(servs))
+	assert.Equal(t, "tcp", servs[0].GetProtocol())
+
+	_, err = NewNaming(filepath.Join(t.TempDir(), "none.json"))
+	assert.NotNil(t, err)
+}
+
+// writeFile replace the file atomically
+func writeFile(path, content string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func TestClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(servicesV1), 0644))
+	ns, err := NewNaming(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, ns.Subscribe("chat", nil))
+	assert.Nil(t, ns.Subscribe("wgateway", nil))
+	watches := []*Watch{ns.watches["chat"], ns.watches["wgateway"]}
+
+	assert.Nil(t, ns.Close())
+	for _, wh := range watches {
+		select {
+		case <-wh.Quit:
+		default:
+			t.Fatalf("watch of %s is not stopped", wh.Service)
+		}
+	}
+	assert.Equal(t, 0, len(ns.watches))
+	// unsubscribing after close is a no-op
+	assert.Nil(t, ns.Unsubscribe("chat"))
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"errors"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"sort"
+	"sync"
+)
+
+// Naming is an in-process naming.Naming, services registered
+// are only visible to the same process. it is mostly used to run
+// gateways and logic services in a single test binary
+type Naming struct {
+	sync.RWMutex
+	services map[string]*naming.DefaultService
+	watches  map[string]*Watch
+}
+
+type Watch struct {
+	Service  string
+	Tags     []string
+	Callback func([]wxf.ServiceRegistration)
+	notify   chan struct{}
+	Quit     chan struct{}
+}
+
+func NewNaming() naming.Naming {
+	return &Naming{
+		services: make(map[string]*naming.DefaultService),
+		watches:  make(map[string]*Watch, 1),
+	}
+}
+
+func (n *Naming) Find(serviceName string, tags ...string) ([]wxf.ServiceRegistration, error) {
+	n.RLock()
+	defer n.RUnlock()
+	services := make([]wxf.ServiceRegistration, 0)
+	for _, s := range n.services {
+		if s.Name != serviceName || !s.HasTags(tags...) {
+			continue
+		}
+		services = append(services, s.Clone())
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceID() < services[j].ServiceID()
+	})
+	return services, nil
+}
+
+func (n *Naming) Subscribe(serviceName string, callback func([]wxf.ServiceRegistration)) error {
+	return n.SubscribeWithFilter(serviceName, nil, callback)
+}
+
+// SubscribeWithFilter watches services of serviceName which have all of tags,
+// changes of the services without these tags are not notified
+func (n *Naming) SubscribeWithFilter(serviceName string, tags []string, callback func([]wxf.ServiceRegistration)) error {
+	n.Lock()
+	defer n.Unlock()
+	if _, ok := n.watches[serviceName]; ok {
+		return errors.New("serviceName has already been registered")
+	}
+	w := &Watch{
+		Service:  serviceName,
+		Tags:     tags,
+		Callback: callback,
+		notify:   make(chan struct{}, 1),
+		Quit:     make(chan struct{}),
+	}
+	n.watches[serviceName] = w
+
+	go n.watch(w)
+	return nil
+}
+
+func (n *Naming) Unsubscribe(serviceName string) error {
+	n.Lock()
+	defer n.Unlock()
+	wh, ok := n.watches[serviceName]
+	delete(n.watches, serviceName)
+
+	if ok {
+		close(wh.Quit)
+	}
+	return nil
+}
+
+func (n *Naming) Register(s wxf.ServiceRegistration) error {
+	service := &naming.DefaultService{
+		Id:        s.ServiceID(),
+		Name:      s.ServiceName(),
+		Address:   s.PublicAddress(),
+		Port:      s.PublicPort(),
+		Protocol:  s.GetProtocol(),
+		Namespace: s.GetNamespace(),
+		Tags:      s.GetTags(),
+		Meta:      s.GetMeta(),
+	}
+	n.Lock()
+	defer n.Unlock()
+	old, ok := n.services[s.ServiceID()]
+	n.services[s.ServiceID()] = service.Clone()
+	if ok {
+		n.changed(old)
+	}
+	n.changed(service)
+	return nil
+}
+
+func (n *Naming) Deregister(serviceID string) error {
+	n.Lock()
+	defer n.Unlock()
+	s, ok := n.services[serviceID]
+	if !ok {
+		return nil
+	}
+	delete(n.services, serviceID)
+	n.changed(s)
+	return nil
+}
+
+// changed notify the watch of the service s if s has all of its tags,
+// notifications are merged if the watch is still busy with the previous one
+func (n *Naming) changed(s *naming.DefaultService) {
+	wh, ok := n.watches[s.Name]
+	if !ok || !s.HasTags(wh.Tags...) {
+		return
+	}
+	select {
+	case wh.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Naming) watch(wh *Watch) {
+	for {
+		select {
+		case <-wh.Quit:
+			return
+		case <-wh.notify:
+			services, _ := n.Find(wh.Service, wh.Tags...)
+			if wh.Callback != nil {
+				wh.Callback(services)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"testing"
+	"time"
+)
+
+func Test_Naming(t *testing.T) {
+	ns := NewNaming()
+
+	serviceName := "for_test"
+	err := ns.Register(&naming.DefaultService{
+		Id:       "test_1",
+		Name:     serviceName,
+		Address:  "localhost",
+		Port:     8000,
+		Protocol: "ws",
+		Tags:     []string{"tag1", "gate"},
+		Meta:     map[string]string{"zone": "zone_a"},
+	})
+	assert.Nil(t, err)
+
+	servs, err := ns.Find(serviceName)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(servs))
+	assert.Equal(t, "ws", servs[0].GetProtocol())
+	// services found are copies
+	servs[0].GetMeta()["zone"] = "zone_b"
+	servs, _ = ns.Find(serviceName)
+	assert.Equal(t, "zone_a", servs[0].GetMeta()["zone"])
+
+	notified := make(chan []wxf.ServiceRegistration, 10)
+	err = ns.Subscribe(serviceName, func(services []wxf.ServiceRegistration) {
+		notified <- services
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, ns.Subscribe(serviceName, nil))
+
+	err = ns.Register(&naming.DefaultService{
+		Id:       "test_2",
+		Name:     serviceName,
+		Address:  "localhost",
+		Port:     8001,
+		Protocol: "ws",
+		Tags:     []string{"tab2", "gate"},
+	})
+	assert.Nil(t, err)
+
+	select {
+	case services := <-notified:
+		assert.Equal(t, 2, len(services))
+		assert.Equal(t, "test_2", services[1].ServiceID())
+	case <-time.After(time.Second):
+		t.Fatal("subscriber is not notified")
+	}
+
+	// tag filtering
+	servs, _ = ns.Find(serviceName, "gate")
+	assert.Equal(t, 2, len(servs))
+	servs, _ = ns.Find(serviceName, "tab2")
+	assert.Equal(t, 1, len(servs))
+	assert.Equal(t, "test_2", servs[0].ServiceID())
+	servs, _ = ns.Find(serviceName, "tab2", "tag1")
+	assert.Equal(t, 0, len(servs))
+
+	// other services do not notify the subscriber
+	_ = ns.Register(&naming.DefaultService{Id: "other_1", Name: "other"})
+
+	err = ns.Deregister("test_2")
+	assert.Nil(t, err)
+	select {
+	case services := <-notified:
+		assert.Equal(t, 1, len(services))
+		assert.Equal(t, "test_1", services[0].ServiceID())
+	case <-time.After(time.Second):
+		t.Fatal("subscriber is not notified")
+	}
+
+	_ = ns.Unsubscribe(serviceName)
+	_ = ns.Deregister("test_1")
+	select {
+	case <-notified:
+		t.Fatal("subscriber is notified after unsubscribe")
+	case <-time.After(time.Millisecond * 100):
+	}
+	servs, _ = ns.Find(serviceName)
+	assert.Equal(t, 0, len(servs))
+}
+
+func Test_SubscribeWithFilter(t *testing.T) {
+	ns := NewNaming().(*Naming)
+
+	notified := make(chan []wxf.ServiceRegistration, 10)
+	err := ns.SubscribeWithFilter("chat", []string{"gate"}, func(services []wxf.ServiceRegistration) {
+		notified <- services
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, ns.Subscribe("chat", nil))
+
+	_ = ns.Register(&naming.DefaultService{Id: "chat_1", Name: "chat", Tags: []string{"gate"}})
+	select {
+	case services := <-notified:
+		assert.Equal(t, 1, len(services))
+		assert.Equal(t, "chat_1", services[0].ServiceID())
+	case <-time.After(time.Second):
+		t.Fatal("subscriber is not notified")
+	}
+
+	// services without the tags are neither notified nor returned
+	_ = ns.Register(&naming.DefaultService{Id: "chat_2", Name: "chat", Tags: []string{"logic"}})
+	_ = ns.Deregister("chat_2")
+	select {
+	case <-notified:
+		t.Fatal("subscriber is notified by a service without the tags")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	_ = ns.Register(&naming.DefaultService{Id: "chat_3", Name: "chat", Tags: []string{"gate", "zone_a"}})
+	select {
+	case services := <-notified:
+		assert.Equal(t, 2, len(services))
+		assert.Equal(t, "chat_3", services[1].ServiceID())
+	case <-time.After(time.Second):
+		t.Fatal("subscriber is not notified")
+	}
+
+	// dropping the tags removes the service from the watch
+	_ = ns.Register(&naming.DefaultService{Id: "chat_3", Name: "chat", Tags: []string{"zone_a"}})
+	select {
+	case services := <-notified:
+		assert.Equal(t, 1, len(services))
+		assert.Equal(t, "chat_1", services[0].ServiceID())
+	case <-time.After(time.Second):
+		t.Fatal("subscriber is not notified")
+	}
+	_ = ns.Unsubscribe("chat")
+}
@@ -1,6 +1,9 @@
 package naming
 
-import "github.com/wangxuefeng90923/wxf"
+import (
+	"github.com/wangxuefeng90923/wxf"
+	"time"
+)
 
 type Naming interface {
 	Find(serviceName string, tags ...string) ([]wxf.ServiceRegistration, error)
@@ -9,3 +12,11 @@ type Naming interface {
 	Register(registration wxf.ServiceRegistration) error
 	Deregister(string) error
 }
+
+// Heartbeater is implemented by namings whose registrations expire
+// unless the registered service heartbeats every HeartbeatInterval
+type Heartbeater interface {
+	Heartbeat(serviceID string) error
+	// HeartbeatInterval returns 0 if heartbeat is not required
+	HeartbeatInterval() time.Duration
+}
@@ -66,3 +66,31 @@ func NewEntry(id, name, protocol string, address string, port int) *DefaultServi
 		Protocol: protocol,
 	}
 }
+
+// Clone returns a deep copy of s
+func (s *DefaultService) Clone() *DefaultService {
+	cp := *s
+	cp.Tags = append([]string(nil), s.Tags...)
+	cp.Meta = make(map[string]string, len(s.Meta))
+	for k, v := range s.Meta {
+		cp.Meta[k] = v
+	}
+	return &cp
+}
+
+// HasTags reports whether s is tagged with all of tags
+func (s *DefaultService) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range s.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
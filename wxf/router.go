@@ -2,8 +2,12 @@ package wxf
 
 import (
 	"fmt"
+	"github.com/wangxuefeng90923/wxf/metrics"
+	"github.com/wangxuefeng90923/wxf/tracing"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"go.opentelemetry.io/otel/trace"
 	"sync"
+	"time"
 )
 
 type Router struct {
@@ -11,6 +15,8 @@ type Router struct {
 	// registered listener list
 	handlers *FuncTree
 	pool     sync.Pool
+	// apps allowed to be served, sessions of any app are served if empty
+	apps map[string]*App
 }
 
 type FuncTree struct {
@@ -44,15 +50,48 @@ func (r *Router) Serve(packet *pkt.LogicPkt, dispatcher Dispatcher,
 	ctx.reset()
 	ctx.request = packet
 	ctx.Dispatcher = dispatcher
-	ctx.SessionStorage = cache
 	ctx.session = session
+	// sessions of an app are isolated from other apps
+	var appID string
+	if session != nil {
+		appID = session.GetApp()
+	}
+	ctx.app = r.appOf(appID)
+	ctx.SessionStorage = NewAppStorage(cache, appID)
 
+	traceCtx, span := tracing.Start(&packet.Header, "router.serve "+packet.Command,
+		trace.WithSpanKind(trace.SpanKindServer))
+	ctx.traceCtx = traceCtx
+	start := time.Now()
 	r.serveContext(ctx)
+	span.End()
+	metrics.HandlerDuration.WithLabelValues(packet.Command).Observe(time.Since(start).Seconds())
 	r.pool.Put(ctx)
 	return nil
 }
 
+// SetApps restricts the router to apps, sessions of other apps are rejected
+func (r *Router) SetApps(apps ...*App) {
+	r.apps = make(map[string]*App, len(apps))
+	for _, app := range apps {
+		r.apps[app.ID] = app
+	}
+}
+
+// appOf returns the configuration of app, or nil if it is not allowed
+func (r *Router) appOf(id string) *App {
+	if len(r.apps) == 0 {
+		return &App{ID: id}
+	}
+	return r.apps[id]
+}
+
 func (r *Router) serveContext(ctx *ContextImpl) {
+	if ctx.app == nil || !ctx.app.Allow(ctx.Header().Command) {
+		ctx.handlers = []HandlerFunc{handleNotAllowed}
+		ctx.Next()
+		return
+	}
 	chain, ok := r.handlers.Get(ctx.Header().Command)
 	if !ok {
 		ctx.handlers = []HandlerFunc{handleNoFound}
@@ -71,6 +110,10 @@ func handleNoFound(ctx Context) {
 	ctx.Resp(pkt.Status_NotImplemented, &pkt.ErrorResp{Message: "NotImplemented"})
 }
 
+func handleNotAllowed(ctx Context) {
+	ctx.Resp(pkt.Status_Unauthorized, &pkt.ErrorResp{Message: "NotAllowed"})
+}
+
 func (t *FuncTree) Add(path string, handers ...HandlerFunc) {
 	if t.nodes[path] == nil {
 		t.nodes[path] = HandlersChain{}
@@ -0,0 +1,127 @@
+package wxf
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"testing"
+)
+
+// memStorage keeps sessions in memory, one location per account
+type memStorage struct {
+	sessions map[string]*pkt.Session
+	accounts map[string]*Location
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{sessions: map[string]*pkt.Session{}, accounts: map[string]*Location{}}
+}
+
+func (m *memStorage) Add(session *pkt.Session) error {
+	m.sessions[session.ChannelId] = session
+	m.accounts[session.Account] = &Location{ChannelId: session.ChannelId, GateId: session.GateId}
+	return nil
+}
+
+func (m *memStorage) Delete(account string, channelId string) error {
+	delete(m.accounts, account)
+	delete(m.sessions, channelId)
+	return nil
+}
+
+func (m *memStorage) Get(channelId string) (*pkt.Session, error) {
+	if s, ok := m.sessions[channelId]; ok {
+		return s, nil
+	}
+	return nil, ErrSessionNil
+}
+
+func (m *memStorage) GetLocations(accounts ...string) ([]*Location, error) {
+	var locs []*Location
+	for _, a := range accounts {
+		if loc, ok := m.accounts[a]; ok {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+func (m *memStorage) GetLocation(account string, device string) (*Location, error) {
+	if loc, ok := m.accounts[account]; ok {
+		return loc, nil
+	}
+	return nil, ErrSessionNil
+}
+
+type pushed struct {
+	channels []string
+	packet   *pkt.LogicPkt
+}
+
+type recordDispatcher struct {
+	pushes []pushed
+}
+
+func (d *recordDispatcher) Push(gateway string, channels []string, p *pkt.LogicPkt) error {
+	d.pushes = append(d.pushes, pushed{channels, p})
+	return nil
+}
+
+func TestAppIsolation(t *testing.T) {
+	storage := newMemStorage()
+	bob1 := &pkt.Session{ChannelId: "ch1", GateId: "gate", Account: "bob", App: "app1"}
+	bob2 := &pkt.Session{ChannelId: "ch2", GateId: "gate", Account: "bob", App: "app2"}
+	assert.Nil(t, NewAppStorage(storage, "app1").Add(bob1))
+	assert.Nil(t, NewAppStorage(storage, "app2").Add(bob2))
+	assert.Equal(t, ErrAppMismatch, NewAppStorage(storage, "app1").Add(bob2))
+	// accounts are stored in the namespace of app
+	assert.Equal(t, "bob", bob1.Account)
+	session, err := GetSession(storage, "ch1")
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", session.Account)
+
+	var found []*Location
+	r := NewRouter()
+	r.Handle("chat.user.talk", func(ctx Context) {
+		assert.Equal(t, "app1", ctx.App().ID)
+		found, _ = ctx.GetLocations(ctx.Header().Dest)
+		_, err := ctx.Get("ch2")
+		assert.Equal(t, ErrSessionNil, err)
+	})
+	talk := pkt.New("chat.user.talk", pkt.WithDest("bob"))
+	sender := &pkt.Session{ChannelId: "ch3", GateId: "gate", Account: "alice", App: "app1"}
+	assert.Nil(t, r.Serve(talk, new(recordDispatcher), storage, sender))
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, "ch1", found[0].ChannelId)
+}
+
+func TestAppCommands(t *testing.T) {
+	r := NewRouter()
+	r.SetApps(&App{ID: "app1", Commands: []string{"chat.user.talk"}, Features: map[string]string{"offline": "on"}})
+	served := 0
+	r.Handle("chat.user.talk", func(ctx Context) {
+		v, _ := ctx.App().Feature("offline")
+		assert.Equal(t, "on", v)
+		served++
+	})
+	r.Handle("chat.group.talk", func(ctx Context) {
+		served++
+	})
+
+	serve := func(command, app string) *pkt.LogicPkt {
+		d := new(recordDispatcher)
+		session := &pkt.Session{ChannelId: "ch1", GateId: "gate", App: app}
+		assert.Nil(t, r.Serve(pkt.New(command), d, newMemStorage(), session))
+		if len(d.pushes) == 0 {
+			return nil
+		}
+		return d.pushes[0].packet
+	}
+	assert.Nil(t, serve("chat.user.talk", "app1"))
+	assert.Equal(t, 1, served)
+
+	resp := serve("chat.group.talk", "app1")
+	assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+	resp = serve("chat.user.talk", "app2")
+	assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+	assert.Equal(t, 1, served)
+}
@@ -2,10 +2,15 @@ package wxf
 
 import (
 	"context"
+	"errors"
 	"net"
 	"time"
 )
 
+// ErrServerClosed is returned by Start of a server which is shut down
+// before it is started
+var ErrServerClosed = errors.New("server closed")
+
 // Server handles:
 // 1. Start itself for upper service to activate services
 // (however handshake is not handled here, needs to send callback to upper accept layer)
@@ -23,6 +28,8 @@ type Server interface {
 
 	Start() error
 	Push(string, []byte) error
+	// PushFrame pushes a frame shared by many channels
+	PushFrame(string, *PreparedFrame) error
 	Shutdown(context.Context) error
 }
 
@@ -32,6 +39,22 @@ type Acceptor interface {
 	Accept(Conn, time.Duration) (string, error)
 }
 
+// FrameNegotiator is optionally implemented by Acceptor, the encoder
+// and the max frame size negotiated in Accept are set to the channel
+type FrameNegotiator interface {
+	// FrameEncoder returns nil for binary frames
+	FrameEncoder(channelID string) FrameEncoder
+	// MaxFrameSize returns 0 if the frame size is unlimited
+	MaxFrameSize(channelID string) uint32
+}
+
+// FrameEncoder encodes payloads pushed to a channel into frames, channels
+// encoding in the same way should share an encoder, as a frame pushed to
+// many channels is encoded once for each encoder. it must be comparable
+type FrameEncoder interface {
+	EncodeFrame(payload []byte) (OpCode, []byte, error)
+}
+
 type MessageListener interface {
 	Receive(Agent, []byte)
 }
@@ -73,8 +96,11 @@ type Channel interface {
 	Agent
 	Close() error
 	Readloop(msgLst MessageListener) error
+	PushFrame(*PreparedFrame) error
 	SetWriteWait(time.Duration)
 	SetReadWait(time.Duration)
+	SetFrameEncoder(FrameEncoder)
+	SetMaxFrameSize(uint32)
 }
 
 type OpCode byte
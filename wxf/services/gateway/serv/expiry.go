@@ -0,0 +1,98 @@
+package serv
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultExpiryInterval is the interval of closing channels whose
+// tokens expired without refresh
+const DefaultExpiryInterval = time.Second * 10
+
+var ErrTokenMismatch = errors.New("token is not of the account of channel")
+
+// channelToken is the token of a channel, it is renewed by login.refresh
+type channelToken struct {
+	account string
+	app     string
+	exp     int64
+}
+
+func (t *channelToken) expired(now int64) bool {
+	exp := atomic.LoadInt64(&t.exp)
+	return exp > 0 && exp < now
+}
+
+// refresh validates the token in a login.refresh packet for the account
+// of channel, the body is replaced by the session with new expiry which
+// is forwarded to login service
+func (x *Handler) refresh(agent wxf.Agent, p *pkt.LogicPkt) error {
+	v, ok := x.tokens.Load(agent.ID())
+	if !ok {
+		return ErrTokenMismatch
+	}
+	ct := v.(*channelToken)
+	var req pkt.LoginReq
+	if err := p.ReadBody(&req); err != nil {
+		return err
+	}
+	tk, err := x.keyring().Parse(req.Token)
+	if err != nil {
+		return err
+	}
+	if tk.Account != ct.account || tk.App != ct.app {
+		return ErrTokenMismatch
+	}
+	if err = x.checkRevoked(tk); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&ct.exp, tk.Exp)
+	p.WriteBody(&pkt.Session{
+		ChannelId: agent.ID(),
+		Account:   tk.Account,
+		App:       tk.App,
+		ExpiresAt: tk.Exp,
+	})
+	return nil
+}
+
+// CloseExpired closes channels whose tokens expired, it returns the
+// count of channels closed
+func (x *Handler) CloseExpired(channels wxf.ChannelMap) int {
+	now := time.Now().Unix()
+	closed := 0
+	x.tokens.Range(func(key, value any) bool {
+		if !value.(*channelToken).expired(now) {
+			return true
+		}
+		id := key.(string)
+		x.tokens.Delete(id)
+		if ch, ok := channels.Get(id); ok {
+			log.WithFields(logrus.Fields{"id": id}).Info("close channel as token expired")
+			_ = ch.Close()
+			closed++
+		}
+		return true
+	})
+	return closed
+}
+
+// WatchExpiry closes channels whose tokens expired every interval until
+// ctx is done
+func (x *Handler) WatchExpiry(ctx context.Context, channels wxf.ChannelMap, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			x.CloseExpired(channels)
+		}
+	}
+}
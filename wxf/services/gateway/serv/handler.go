@@ -2,14 +2,19 @@ package serv
 
 import (
 	"bytes"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/wangxuefeng90923/wxf"
 	"github.com/wangxuefeng90923/wxf/container"
+	"github.com/wangxuefeng90923/wxf/tracing"
 	"github.com/wangxuefeng90923/wxf/wire"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
 	"github.com/wangxuefeng90923/wxf/wire/token"
+	"go.opentelemetry.io/otel/trace"
 	"regexp"
+	"sync"
 	"time"
 )
 
@@ -18,6 +23,15 @@ const (
 	MetaKeyAccount = "account"
 )
 
+// sessionSecretSize is the size of HMAC key issued in login
+const sessionSecretSize = 32
+
+var (
+	ErrTokenRevoked      = errors.New("token is revoked")
+	ErrChannelRepeated   = errors.New("channelId is repeated")
+	ErrCommandNotAllowed = errors.New("command is not allowed")
+)
+
 var log = logrus.WithFields(logrus.Fields{
 	"service": "gateway",
 	"pkg":     "serv",
@@ -25,12 +39,159 @@ var log = logrus.WithFields(logrus.Fields{
 
 type Handler struct {
 	ServiceID string
+	// Container forwards messages to logic services,
+	// container.Default() is used if it is nil
+	Container *container.Container
+	// Capabilities supported by gateway, DefaultCapabilities() if nil
+	Capabilities *pkt.Capabilities
+	// Keyring verifies tokens in login, all tokens are rejected if nil
+	Keyring *token.Keyring
+	// Revocations are checked in login if it is set
+	Revocations token.Revocations
+	// MaxClockSkew of signed packets, DefaultMaxClockSkew if 0
+	MaxClockSkew time.Duration
+	// capabilities negotiated by channels
+	caps sync.Map
+	// encoders of channels in text mode or with a negotiated compression
+	encoders sync.Map
+	// guards of channels which negotiated integrity
+	guards sync.Map
+	// tokens of channels, channels are closed when tokens expire
+	tokens sync.Map
+}
+
+func (x *Handler) container() *container.Container {
+	if x.Container == nil {
+		return container.Default()
+	}
+	return x.Container
+}
+
+// DefaultCapabilities supported by gateway
+func DefaultCapabilities() *pkt.Capabilities {
+	return &pkt.Capabilities{
+		Compressions: []string{wire.CompressionZstd, wire.CompressionSnappy},
+		ContentTypes: []pkt.ContentType{pkt.ContentType_Protobuf, pkt.ContentType_Json},
+		Ack:          true,
+		Integrity:    true,
+	}
+}
+
+// emptyKeyring rejects all tokens
+var emptyKeyring = token.NewKeyring()
+
+func (x *Handler) keyring() *token.Keyring {
+	if x.Keyring == nil {
+		return emptyKeyring
+	}
+	return x.Keyring
+}
+
+// checkRevoked returns ErrTokenRevoked if tk is revoked
+func (x *Handler) checkRevoked(tk *token.Token) error {
+	if x.Revocations == nil {
+		return nil
+	}
+	revoked, err := x.Revocations.Revoked(tk)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (x *Handler) capabilities() *pkt.Capabilities {
+	if x.Capabilities == nil {
+		return DefaultCapabilities()
+	}
+	return x.Capabilities
+}
+
+// FrameEncoder implements wxf.FrameNegotiator, packets are pushed in
+// JSON text frames to channels in text mode, and are compressed for
+// channels which negotiated a compression
+func (x *Handler) FrameEncoder(channelID string) wxf.FrameEncoder {
+	if enc, ok := x.encoders.Load(channelID); ok {
+		return enc.(*frameEncoder)
+	}
+	return nil
+}
+
+// MaxFrameSize implements wxf.FrameNegotiator
+func (x *Handler) MaxFrameSize(channelID string) uint32 {
+	if caps, ok := x.caps.Load(channelID); ok {
+		return caps.(*pkt.Capabilities).MaxFrameSize
+	}
+	return 0
+}
+
+// ack acknowledges the logic packet p to the channel if ack is negotiated
+func (x *Handler) ack(agent wxf.Agent, p *pkt.LogicPkt) {
+	caps, ok := x.caps.Load(agent.ID())
+	if !ok || !caps.(*pkt.Capabilities).Ack {
+		return
+	}
+	_ = agent.Push(pkt.Marshal(pkt.NewAck(p.Sequence)))
+}
+
+func (x *Handler) isText(channelID string) bool {
+	enc, ok := x.encoders.Load(channelID)
+	return ok && enc.(*frameEncoder).text
+}
+
+type frameEncoder struct {
+	text        bool
+	compression string
+}
+
+// frameEncoders are shared by channels, so that frames pushed to
+// channels of the same kind are encoded once
+var frameEncoders sync.Map
+
+func encoderOf(text bool, compression string) *frameEncoder {
+	key := frameEncoder{text: text, compression: compression}
+	enc, _ := frameEncoders.LoadOrStore(key, &key)
+	return enc.(*frameEncoder)
+}
+
+func (e *frameEncoder) EncodeFrame(payload []byte) (wxf.OpCode, []byte, error) {
+	packet, err := pkt.Unmarshal(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	logicPkt, ok := packet.(*pkt.LogicPkt)
+	if !ok {
+		if !e.text {
+			return wxf.OpBinary, payload, nil
+		}
+		text, err := pkt.MarshalBasicText(packet.(*pkt.BasicPkt))
+		if err != nil {
+			return 0, nil, err
+		}
+		return wxf.OpText, text, nil
+	}
+	// bodies are always raw in text frames
+	if err = logicPkt.CompressBody(e.compression); err != nil {
+		return 0, nil, err
+	}
+	if !e.text {
+		return wxf.OpBinary, pkt.Marshal(logicPkt), nil
+	}
+	text, err := pkt.MarshalText(logicPkt)
+	if err != nil {
+		return 0, nil, err
+	}
+	return wxf.OpText, text, nil
 }
 
 func (x *Handler) Disconnect(id string) error {
 	log.Infof("disconnect %s", id)
+	x.release(id)
 	logoutPkt := pkt.New(wire.CommandLoginSignOut, pkt.WithChannel(id))
-	err := container.Forward(wire.SNLogin, logoutPkt)
+	logoutPkt.SetStringMeta(wire.MetaGateway, x.ServiceID)
+	err := x.container().Forward(wire.SNLogin, logoutPkt)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"module": "handler",
@@ -41,8 +202,15 @@ func (x *Handler) Disconnect(id string) error {
 }
 
 func (x *Handler) Receive(agent wxf.Agent, payload []byte) {
-	buf := bytes.NewBuffer(payload)
-	packet, err := pkt.Read(buf)
+	var (
+		packet interface{}
+		err    error
+	)
+	if x.isText(agent.ID()) {
+		packet, err = pkt.ReadText(payload)
+	} else {
+		packet, err = pkt.Unmarshal(payload)
+	}
 	if err != nil {
 		return
 	}
@@ -58,19 +226,66 @@ func (x *Handler) Receive(agent wxf.Agent, payload []byte) {
 	// case LogicPkt, transfer to logic service
 	if logicPkt, ok := packet.(*pkt.LogicPkt); ok {
 		logicPkt.ChannelId = agent.ID()
+		if err = x.verify(agent.ID(), logicPkt); err != nil {
+			x.reject(agent, logicPkt, err)
+			return
+		}
+		// login packets are originated by gateway only
+		if wire.GatewayCommands[logicPkt.Command] {
+			x.reject(agent, logicPkt, ErrCommandNotAllowed)
+			return
+		}
+		logicPkt.DelMeta(wire.MetaGateway)
 
-		err = container.Forward(logicPkt.ServiceName(), logicPkt)
+		// traces start at gateway, those of clients are dropped
+		tracing.Strip(&logicPkt.Header)
+		_, span := tracing.Start(&logicPkt.Header, "gateway.receive", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		serviceName := logicPkt.ServiceName()
+		if logicPkt.Command == wire.CommandLoginRefresh {
+			if err = x.refresh(agent, logicPkt); err != nil {
+				span.RecordError(err)
+				x.reject(agent, logicPkt, err)
+				return
+			}
+			logicPkt.SetStringMeta(wire.MetaGateway, x.ServiceID)
+			serviceName = wire.SNLogin
+		}
+		err = x.container().Forward(serviceName, logicPkt)
 		if err != nil {
+			span.RecordError(err)
 			logrus.WithFields(logrus.Fields{
 				"module": "handler",
 				"id":     agent.ID(),
 				"cmd":    logicPkt.Command,
 				"dest":   logicPkt.Dest,
 			}).Error(err)
+			return
 		}
+		x.ack(agent, logicPkt)
 	}
 }
 
+// reject drops a packet failing the integrity check or refresh, replayed
+// packets are dropped silently as the sequence may be retransmitted by SDK
+// when the ack is lost, so they are acknowledged again
+func (x *Handler) reject(agent wxf.Agent, p *pkt.LogicPkt, err error) {
+	logrus.WithFields(logrus.Fields{
+		"module": "handler",
+		"id":     agent.ID(),
+		"cmd":    p.Command,
+		"seq":    p.Sequence,
+	}).Warn(err)
+	if err == ErrPacketReplayed {
+		x.ack(agent, p)
+		return
+	}
+	resp := pkt.NewFrom(&p.Header)
+	resp.Status = pkt.Status_Unauthorized
+	resp.WriteBody(&pkt.ErrorResp{Message: err.Error()})
+	_ = agent.Push(pkt.Marshal(resp))
+}
+
 func (x *Handler) Accept(conn wxf.Conn, timeout time.Duration) (string, error) {
 	log := logrus.WithFields(logrus.Fields{
 		"ServiceID": x.ServiceID,
@@ -85,16 +300,31 @@ func (x *Handler) Accept(conn wxf.Conn, timeout time.Duration) (string, error) {
 		return "", err
 	}
 
-	buf := bytes.NewBuffer(frame.GetPayload())
-	req, err := pkt.MustReadLogicPkt(buf)
+	// browser clients log in with a text frame
+	text := frame.GetOpCode() == wxf.OpText
+	var req *pkt.LogicPkt
+	if text {
+		req, err = pkt.ReadTextPkt(frame.GetPayload())
+	} else {
+		req, err = pkt.MustReadLogicPkt(bytes.NewBuffer(frame.GetPayload()))
+	}
 	if err != nil {
 		return "", err
 	}
+	writeResp := func(resp *pkt.LogicPkt) {
+		if !text {
+			_ = conn.WriteFrame(wxf.OpBinary, pkt.Marshal(resp))
+			return
+		}
+		if payload, err := pkt.MarshalText(resp); err == nil {
+			_ = conn.WriteFrame(wxf.OpText, payload)
+		}
+	}
 	// 2. it must be a login packet
 	if req.Command != wire.CommandLoginSignIn {
 		resp := pkt.NewFrom(&req.Header)
 		resp.Status = pkt.Status_InvalidCommand
-		_ = conn.WriteFrame(wxf.OpBinary, pkt.Marshal(resp))
+		writeResp(resp)
 		return "", fmt.Errorf("acceptor receive a InvalidCommand command")
 	}
 	// 3. Unmarshal body
@@ -103,34 +333,94 @@ func (x *Handler) Accept(conn wxf.Conn, timeout time.Duration) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	// 4. decode token with DefaultSecret
-	tk, err := token.Parse(token.DefaultSecret, login.Token)
+	// 4. decode token with the keyring
+	tk, err := x.keyring().Parse(login.Token)
 	if err != nil {
 		// 5. ineffective token, return to SDK an Unauthorized Msg
 		resq := pkt.NewFrom(&req.Header)
 		resq.Status = pkt.Status_Unauthorized
-		_ = conn.WriteFrame(wxf.OpBinary, pkt.Marshal(resq))
+		writeResp(resq)
+		return "", err
+	}
+	if err = x.checkRevoked(tk); err != nil {
+		resp := pkt.NewFrom(&req.Header)
+		resp.Status = pkt.Status_Unauthorized
+		if err != ErrTokenRevoked {
+			resp.Status = pkt.Status_SystemException
+		}
+		writeResp(resp)
 		return "", err
 	}
 	// 6. generate a global unique ChannelID
 	id := generateChannelID(x.ServiceID, tk.Account)
 
 	req.ChannelId = id
+	req.SetStringMeta(wire.MetaGateway, x.ServiceID)
+	tracing.Strip(&req.Header)
+	_, span := tracing.Start(&req.Header, "gateway.accept", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	// negotiate protocol version and capabilities with SDK
+	version, caps := pkt.Negotiate(login.Version, login.Capabilities, x.capabilities())
+	if text {
+		caps.Compressions = nil
+	}
+	var secret []byte
+	if caps.Integrity {
+		secret = make([]byte, sessionSecretSize)
+		if _, err = rand.Read(secret); err != nil {
+			return "", err
+		}
+	}
 	req.WriteBody(&pkt.Session{
-		ChannelId: id,
-		GateId:    x.ServiceID,
-		Account:   tk.Account,
-		RemoteIP:  getIP(conn.RemoteAddr().String()),
-		App:       tk.App,
+		ChannelId:    id,
+		GateId:       x.ServiceID,
+		Account:      tk.Account,
+		RemoteIP:     getIP(conn.RemoteAddr().String()),
+		App:          tk.App,
+		Version:      version,
+		Capabilities: caps,
+		Secret:       secret,
+		ExpiresAt:    tk.Exp,
 	})
 	// 7. transfer login to Login service
-	err = container.Forward(wire.SNLogin, req)
+	if err = x.store(id, text, caps, secret, tk); err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	err = x.container().Forward(wire.SNLogin, req)
 	if err != nil {
+		x.release(id)
+		span.RecordError(err)
 		return "", err
 	}
 	return id, nil
 }
 
+// store states of channel id, the token is stored first so that a repeated
+// id is rejected before it overwrites states of the existing channel
+func (x *Handler) store(id string, text bool, caps *pkt.Capabilities, secret []byte, tk *token.Token) error {
+	ct := &channelToken{account: tk.Account, app: tk.App, exp: tk.Exp}
+	if _, loaded := x.tokens.LoadOrStore(id, ct); loaded {
+		return ErrChannelRepeated
+	}
+	x.caps.Store(id, caps)
+	if text || caps.Compression() != "" {
+		x.encoders.Store(id, encoderOf(text, caps.Compression()))
+	}
+	if caps.Integrity {
+		x.guards.Store(id, &replayGuard{secret: secret})
+	}
+	return nil
+}
+
+// release states of channel id
+func (x *Handler) release(id string) {
+	x.caps.Delete(id)
+	x.encoders.Delete(id)
+	x.guards.Delete(id)
+	x.tokens.Delete(id)
+}
+
 var ipExp = regexp.MustCompile(string("\\:[0-9]+$"))
 
 func getIP(remoteAddr string) string {
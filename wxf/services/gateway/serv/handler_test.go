@@ -0,0 +1,390 @@
+package serv
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/container"
+	"github.com/wangxuefeng90923/wxf/websocket"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcceptTextFrame(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	handler := &Handler{ServiceID: "gateway01"}
+
+	go func() {
+		_ = wsutil.WriteClientText(cli, []byte(`{"command":"login.signin","sequence":1,"body":{"token":"invalid"}}`))
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := handler.Accept(websocket.NewConn(srv), time.Second)
+		done <- err
+	}()
+
+	payload, op, err := wsutil.ReadServerData(cli)
+	assert.Nil(t, err)
+	assert.Equal(t, ws.OpText, op)
+	var resp pkt.TextPkt
+	assert.Nil(t, json.Unmarshal(payload, &resp))
+	assert.Equal(t, "login.signin", resp.Command)
+	assert.Equal(t, uint32(1), resp.Sequence)
+	assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+	assert.NotNil(t, <-done)
+	assert.Nil(t, handler.FrameEncoder("gateway01_test1"))
+}
+
+func TestTextEncoder(t *testing.T) {
+	handler := &Handler{}
+	handler.encoders.Store("ch1", &frameEncoder{text: true})
+	encoder := handler.FrameEncoder("ch1")
+	assert.NotNil(t, encoder)
+
+	resp := pkt.New("chat.user.talk", pkt.WithContentType(pkt.ContentType_Json))
+	resp.WriteBody(&pkt.ErrorResp{Message: "hello"})
+	code, payload, err := encoder.EncodeFrame(pkt.Marshal(resp))
+	assert.Nil(t, err)
+	assert.Equal(t, wxf.OpText, code)
+	text, err := pkt.ReadTextPkt(payload)
+	assert.Nil(t, err)
+	var body pkt.ErrorResp
+	assert.Nil(t, text.ReadBody(&body))
+	assert.Equal(t, "hello", body.Message)
+
+	// basic packets are in text too
+	pong := pkt.Marshal(&pkt.BasicPkt{Code: pkt.CodePong})
+	code, payload, err = encoder.EncodeFrame(pong)
+	assert.Nil(t, err)
+	assert.Equal(t, wxf.OpText, code)
+	assert.Equal(t, `{"code":2}`, string(payload))
+
+	assert.Nil(t, handler.Disconnect("ch1"))
+	assert.Nil(t, handler.FrameEncoder("ch1"))
+}
+
+func TestCompressEncoder(t *testing.T) {
+	handler := &Handler{}
+	handler.encoders.Store("ch1", &frameEncoder{compression: wire.CompressionZstd})
+	encoder := handler.FrameEncoder("ch1")
+
+	push := pkt.New("chat.group.talk")
+	push.Flag = pkt.Flag_Push
+	push.Body = bytes.Repeat([]byte("hello"), 1000)
+	code, payload, err := encoder.EncodeFrame(pkt.Marshal(push))
+	assert.Nil(t, err)
+	assert.Equal(t, wxf.OpBinary, code)
+	out, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, wire.CompressionZstd, out.Compression())
+	assert.Less(t, len(out.Body), len(push.Body))
+
+	// bodies in text frames are raw
+	handler.encoders.Store("ch2", &frameEncoder{text: true})
+	_, payload, err = handler.FrameEncoder("ch2").EncodeFrame(pkt.Marshal(out))
+	assert.Nil(t, err)
+	text, err := pkt.ReadTextPkt(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, "", text.Compression())
+}
+
+type pushAgent struct {
+	id     string
+	pushed [][]byte
+}
+
+func (a *pushAgent) ID() string { return a.id }
+
+func (a *pushAgent) Push(data []byte) error {
+	a.pushed = append(a.pushed, data)
+	return nil
+}
+
+func TestReplayGuard(t *testing.T) {
+	g := new(replayGuard)
+	assert.True(t, g.accept(5))
+	assert.False(t, g.accept(5))
+	assert.True(t, g.accept(3))
+	assert.True(t, g.accept(7))
+	assert.False(t, g.accept(3))
+	assert.True(t, g.accept(100))
+	// out of window
+	assert.False(t, g.accept(7))
+	assert.True(t, g.accept(100-replayWindowSize+1))
+	assert.False(t, g.accept(100-replayWindowSize))
+
+	// sequences wrap around
+	g = new(replayGuard)
+	assert.True(t, g.accept(math.MaxUint32-1))
+	assert.True(t, g.accept(1))
+	assert.True(t, g.accept(math.MaxUint32))
+	assert.True(t, g.accept(0))
+	assert.False(t, g.accept(math.MaxUint32-1))
+	assert.False(t, g.accept(1))
+	assert.True(t, g.accept(2))
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	handler := &Handler{}
+	handler.guards.Store("ch1", &replayGuard{secret: secret})
+	agent := &pushAgent{id: "ch1"}
+
+	p := pkt.New("chat.user.talk", pkt.WithSeq(2))
+	p.Sign(secret)
+	assert.Nil(t, handler.verify("ch1", p))
+	assert.Equal(t, ErrPacketReplayed, handler.verify("ch1", p))
+	// channels without integrity are not checked
+	assert.Nil(t, handler.verify("ch2", p))
+
+	// timestamp can not be changed without the secret
+	p = pkt.New("chat.user.talk", pkt.WithSeq(3))
+	p.Sign(secret)
+	p.SetIntMeta(wire.MetaTimestamp, time.Now().Add(-time.Minute).UnixMilli())
+	assert.Equal(t, pkt.ErrInvalidSignature, handler.verify("ch1", p))
+	p.Sign(secret)
+	handler.MaxClockSkew = time.Millisecond
+	time.Sleep(time.Millisecond * 5)
+	assert.Equal(t, ErrPacketExpired, handler.verify("ch1", p))
+	handler.MaxClockSkew = 0
+
+	// packets failing the check are rejected before forwarding
+	p = pkt.New("chat.user.talk", pkt.WithSeq(4))
+	handler.Receive(agent, pkt.Marshal(p))
+	assert.Equal(t, 1, len(agent.pushed))
+	resp, err := pkt.MustReadLogicPkt(bytes.NewBuffer(agent.pushed[0]))
+	assert.Nil(t, err)
+	assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+	assert.Equal(t, uint32(4), resp.Sequence)
+
+	assert.Nil(t, handler.Disconnect("ch1"))
+	_, ok := handler.guards.Load("ch1")
+	assert.False(t, ok)
+}
+
+var testKeyring = token.NewKeyring(token.NewHMACKey("", "test-secret"))
+
+func TestKeyringRequired(t *testing.T) {
+	tk, err := token.Generate(token.DefaultSecret, &token.Token{
+		Account: "test1",
+		Exp:     time.Now().Add(time.Hour).Unix(),
+	})
+	assert.Nil(t, err)
+	// tokens are rejected without a keyring, even if signed by the default secret
+	_, err = (&Handler{}).keyring().Parse(tk)
+	assert.NotNil(t, err)
+}
+
+func TestAcceptRevoked(t *testing.T) {
+	revocations := token.NewMemoryRevocations()
+	handler := &Handler{ServiceID: "gateway01", Keyring: testKeyring, Revocations: revocations}
+	tk, err := testKeyring.Generate(&token.Token{
+		Account: "test1",
+		Exp:     time.Now().Add(time.Hour).Unix(),
+	})
+	assert.Nil(t, err)
+	// the token is issued in the second of revocation
+	assert.Nil(t, revocations.RevokeAccount("", "test1", time.Now().Unix()))
+
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	login := pkt.New(wire.CommandLoginSignIn, pkt.WithSeq(1)).WriteBody(&pkt.LoginReq{Token: tk})
+	go func() {
+		_ = wsutil.WriteClientBinary(cli, pkt.Marshal(login))
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := handler.Accept(websocket.NewConn(srv), time.Second)
+		done <- err
+	}()
+
+	payload, err := wsutil.ReadServerBinary(cli)
+	assert.Nil(t, err)
+	resp, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+	assert.Equal(t, ErrTokenRevoked, <-done)
+}
+
+func TestRefresh(t *testing.T) {
+	handler := &Handler{Keyring: testKeyring}
+	exp := time.Now().Add(time.Minute).Unix()
+	handler.tokens.Store("ch1", &channelToken{account: "test1", app: "wxf", exp: exp})
+	agent := &pushAgent{id: "ch1"}
+
+	newToken := func(account string) string {
+		tk, err := testKeyring.Generate(&token.Token{
+			Account: account,
+			App:     "wxf",
+			Exp:     time.Now().Add(time.Hour).Unix(),
+		})
+		assert.Nil(t, err)
+		return tk
+	}
+	// tokens of other accounts are rejected
+	p := pkt.New(wire.CommandLoginRefresh, pkt.WithSeq(5)).WriteBody(&pkt.LoginReq{Token: newToken("test2")})
+	handler.Receive(agent, pkt.Marshal(p))
+	assert.Equal(t, 1, len(agent.pushed))
+	resp, err := pkt.MustReadLogicPkt(bytes.NewBuffer(agent.pushed[0]))
+	assert.Nil(t, err)
+	assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+	assert.Equal(t, uint32(5), resp.Sequence)
+
+	p = pkt.New(wire.CommandLoginRefresh).WriteBody(&pkt.LoginReq{Token: newToken("test1")})
+	assert.Nil(t, handler.refresh(agent, p))
+	var session pkt.Session
+	assert.Nil(t, p.ReadBody(&session))
+	assert.Equal(t, "ch1", session.ChannelId)
+	assert.Equal(t, "test1", session.Account)
+	assert.Greater(t, session.ExpiresAt, exp)
+	v, _ := handler.tokens.Load("ch1")
+	assert.Equal(t, session.ExpiresAt, v.(*channelToken).exp)
+
+	// channels without tokens can not be refreshed
+	assert.Equal(t, ErrTokenMismatch, handler.refresh(&pushAgent{id: "ch2"}, p))
+}
+
+func TestCloseExpired(t *testing.T) {
+	handler := &Handler{}
+	channels := wxf.NewChannels(10)
+	for _, id := range []string{"ch1", "ch2"} {
+		cli, srv := net.Pipe()
+		defer cli.Close()
+		channels.Add(wxf.NewChannel(id, websocket.NewConn(srv)))
+	}
+	handler.tokens.Store("ch1", &channelToken{account: "test1", exp: time.Now().Add(-time.Second).Unix()})
+	handler.tokens.Store("ch2", &channelToken{account: "test2", exp: time.Now().Add(time.Hour).Unix()})
+
+	assert.Equal(t, 1, handler.CloseExpired(channels))
+	_, ok := handler.tokens.Load("ch1")
+	assert.False(t, ok)
+	_, ok = handler.tokens.Load("ch2")
+	assert.True(t, ok)
+	assert.Equal(t, 0, handler.CloseExpired(channels))
+}
+
+func TestStoreRepeated(t *testing.T) {
+	handler := &Handler{}
+	tk := &token.Token{Account: "test1", Exp: time.Now().Add(time.Hour).Unix()}
+	caps := &pkt.Capabilities{Compressions: []string{wire.CompressionSnappy}, Integrity: true}
+	assert.Nil(t, handler.store("ch1", false, caps, []byte("secret"), tk))
+
+	// a repeated id does not overwrite states of the existing channel
+	assert.Equal(t, ErrChannelRepeated, handler.store("ch1", true, &pkt.Capabilities{}, nil, &token.Token{Account: "test2"}))
+	enc, ok := handler.FrameEncoder("ch1").(*frameEncoder)
+	assert.True(t, ok)
+	assert.False(t, enc.text)
+	_, ok = handler.guards.Load("ch1")
+	assert.True(t, ok)
+	ct, _ := handler.tokens.Load("ch1")
+	assert.Equal(t, "test1", ct.(*channelToken).account)
+
+	handler.release("ch1")
+	assert.Nil(t, handler.FrameEncoder("ch1"))
+	_, ok = handler.guards.Load("ch1")
+	assert.False(t, ok)
+	_, ok = handler.tokens.Load("ch1")
+	assert.False(t, ok)
+}
+
+func TestAck(t *testing.T) {
+	secret := []byte("secret")
+	handler := &Handler{Container: container.New()}
+	tk := &token.Token{Account: "test1", Exp: time.Now().Add(time.Hour).Unix()}
+	caps := &pkt.Capabilities{MaxFrameSize: 1024, Ack: true, Integrity: true}
+	assert.Nil(t, handler.store("ch1", false, caps, secret, tk))
+	assert.Equal(t, uint32(1024), handler.MaxFrameSize("ch1"))
+	assert.Equal(t, uint32(0), handler.MaxFrameSize("ch2"))
+	agent := &pushAgent{id: "ch1"}
+
+	// packets failed to forward are not acknowledged
+	p := pkt.New("chat.user.talk", pkt.WithSeq(7))
+	p.Sign(secret)
+	handler.Receive(agent, pkt.Marshal(p))
+	assert.Equal(t, 0, len(agent.pushed))
+
+	// retransmitted packets are acknowledged again
+	handler.Receive(agent, pkt.Marshal(p))
+	assert.Equal(t, 1, len(agent.pushed))
+	ack, err := pkt.MustReadBasicPkt(bytes.NewBuffer(agent.pushed[0]))
+	assert.Nil(t, err)
+	seq, err := ack.AckSequence()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(7), seq)
+
+	handler.release("ch1")
+	assert.Equal(t, uint32(0), handler.MaxFrameSize("ch1"))
+}
+
+func TestSharedEncoder(t *testing.T) {
+	handler := &Handler{}
+	tk := &token.Token{Account: "test1", Exp: time.Now().Add(time.Hour).Unix()}
+	caps := &pkt.Capabilities{Compressions: []string{wire.CompressionZstd}}
+	assert.Nil(t, handler.store("ch1", false, caps, nil, tk))
+	assert.Nil(t, handler.store("ch2", false, caps, nil, tk))
+	assert.Nil(t, handler.store("ch3", true, &pkt.Capabilities{}, nil, tk))
+	assert.Same(t, handler.FrameEncoder("ch1"), handler.FrameEncoder("ch2"))
+	assert.NotSame(t, handler.FrameEncoder("ch1"), handler.FrameEncoder("ch3"))
+
+	push := pkt.New("chat.group.talk")
+	push.Body = bytes.Repeat([]byte("hello"), 1000)
+	frame := wxf.NewPreparedFrame(wxf.OpBinary, pkt.Marshal(push))
+	_, payload1, err := frame.Encode(handler.FrameEncoder("ch1"))
+	assert.Nil(t, err)
+	_, payload2, _ := frame.Encode(handler.FrameEncoder("ch2"))
+	assert.Same(t, &payload1[0], &payload2[0])
+	code, payload3, _ := frame.Encode(handler.FrameEncoder("ch3"))
+	assert.Equal(t, wxf.OpText, code)
+	assert.NotEqual(t, payload1, payload3)
+}
+
+func TestRejectGatewayCommands(t *testing.T) {
+	handler := &Handler{ServiceID: "gateway01", Container: container.New()}
+	tk := &token.Token{Account: "test1", App: "wxf", Exp: time.Now().Add(time.Hour).Unix()}
+	assert.Nil(t, handler.store("ch1", false, &pkt.Capabilities{}, nil, tk))
+	agent := &pushAgent{id: "ch1"}
+
+	for i, command := range []string{wire.CommandLoginSignIn, wire.CommandLoginSignOut, wire.CommandLoginKickout} {
+		p := pkt.New(command, pkt.WithSeq(uint32(i+1)))
+		p.SetStringMeta(wire.MetaGateway, "gateway01")
+		p.WriteBody(&pkt.Session{ChannelId: "ch1", Account: "test2", App: "other"})
+		handler.Receive(agent, pkt.Marshal(p))
+		assert.Equal(t, i+1, len(agent.pushed))
+		resp, err := pkt.MustReadLogicPkt(bytes.NewBuffer(agent.pushed[i]))
+		assert.Nil(t, err)
+		assert.Equal(t, pkt.Status_Unauthorized, resp.Status)
+		assert.Equal(t, command, resp.Command)
+	}
+}
+
+func TestTextPing(t *testing.T) {
+	handler := &Handler{Container: container.New()}
+	tk := &token.Token{Account: "test1", Exp: time.Now().Add(time.Hour).Unix()}
+	assert.Nil(t, handler.store("ch1", true, &pkt.Capabilities{Ack: true}, nil, tk))
+	agent := &pushAgent{id: "ch1"}
+	enc := handler.FrameEncoder("ch1")
+
+	handler.Receive(agent, []byte(`{"code":1}`))
+	assert.Equal(t, 1, len(agent.pushed))
+	code, payload, err := enc.EncodeFrame(agent.pushed[0])
+	assert.Nil(t, err)
+	assert.Equal(t, wxf.OpText, code)
+	assert.Equal(t, `{"code":2}`, string(payload))
+
+	// acks are pushed in text as well
+	handler.ack(agent, pkt.New(wire.CommandChatUserTalk, pkt.WithSeq(7)))
+	assert.Equal(t, 2, len(agent.pushed))
+	code, payload, err = enc.EncodeFrame(agent.pushed[1])
+	assert.Nil(t, err)
+	assert.Equal(t, wxf.OpText, code)
+	assert.Equal(t, `{"code":3,"sequence":7}`, string(payload))
+}
@@ -0,0 +1,86 @@
+package serv
+
+import (
+	"errors"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxClockSkew is the max difference between the timestamp of
+// a signed packet and the clock of gateway
+const DefaultMaxClockSkew = time.Second * 30
+
+// replayWindowSize is the count of sequences tracked below the highest
+// sequence of a channel, older sequences are rejected
+const replayWindowSize = 64
+
+var (
+	ErrPacketExpired  = errors.New("timestamp of packet is out of window")
+	ErrPacketReplayed = errors.New("sequence of packet is replayed")
+)
+
+// replayGuard verifies upstream packets of a channel which negotiated
+// integrity, with a sliding window of sequences
+type replayGuard struct {
+	sync.Mutex
+	secret  []byte
+	started bool
+	last    uint32
+	bitmap  uint64
+}
+
+// accept returns false if seq is received already or is too old, sequences
+// are compared in serial number arithmetic so that they could wrap around
+func (g *replayGuard) accept(seq uint32) bool {
+	g.Lock()
+	defer g.Unlock()
+	if !g.started || int32(seq-g.last) > 0 {
+		shift := seq - g.last
+		if !g.started || shift >= replayWindowSize {
+			g.bitmap = 1
+		} else {
+			g.bitmap = g.bitmap<<shift | 1
+		}
+		g.started = true
+		g.last = seq
+		return true
+	}
+	diff := g.last - seq
+	if diff >= replayWindowSize || g.bitmap&(1<<diff) != 0 {
+		return false
+	}
+	g.bitmap |= 1 << diff
+	return true
+}
+
+func (x *Handler) maxClockSkew() time.Duration {
+	if x.MaxClockSkew <= 0 {
+		return DefaultMaxClockSkew
+	}
+	return x.MaxClockSkew
+}
+
+// verify checks the signature, timestamp and sequence of p if the
+// channel negotiated integrity
+func (x *Handler) verify(channelID string, p *pkt.LogicPkt) error {
+	v, ok := x.guards.Load(channelID)
+	if !ok {
+		return nil
+	}
+	guard := v.(*replayGuard)
+	if err := p.Verify(guard.secret); err != nil {
+		return err
+	}
+	ts, err := p.Timestamp()
+	if err != nil {
+		return pkt.ErrNotSigned
+	}
+	if d := time.Since(ts); d > x.maxClockSkew() || d < -x.maxClockSkew() {
+		return ErrPacketExpired
+	}
+	if !guard.accept(p.Sequence) {
+		return ErrPacketReplayed
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/wangxuefeng90923/wxf/naming/consul"
 	"github.com/wangxuefeng90923/wxf/services/gateway/serv"
 	"github.com/wangxuefeng90923/wxf/services/server/conf"
+	"github.com/wangxuefeng90923/wxf/tracing"
 	"github.com/wangxuefeng90923/wxf/websocket"
 	"github.com/wangxuefeng90923/wxf/wire"
 	"time"
@@ -28,7 +29,22 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	}
 	level, _ := logrus.ParseLevel("trace")
 	logrus.SetLevel(level)
-	handler := &serv.Handler{ServiceID: config.ServiceID}
+	shutdownTracing, err := tracing.Init(config.ServiceName, config.TraceExporter, config.TraceFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+	keyring, err := conf.NewKeyring(config)
+	if err != nil {
+		return err
+	}
+	revocations, err := conf.NewRevocations(config)
+	if err != nil {
+		return err
+	}
+	handler := &serv.Handler{ServiceID: config.ServiceID, Keyring: keyring, Revocations: revocations}
 
 	var srv wxf.Server
 	service := &naming.DefaultService{
@@ -38,10 +54,15 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 		Port:     config.PublicPort,
 		Protocol: opts.protocol,
 		Tags:     config.Tags,
+		Meta: map[string]string{
+			container.KeyServiceZone: config.Zone,
+		},
 	}
 	if opts.protocol == "ws" {
 		srv = websocket.NewServer(config.Listen, service)
 	}
+	channels := wxf.NewChannels(100)
+	srv.SetChannelMap(channels)
 	srv.SetReadWait(time.Minute)
 	srv.SetAcceptor(handler)
 	srv.SetMessageListener(handler)
@@ -49,14 +70,30 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	err = container.Init(srv, wire.SNChat, wire.SNLogin)
 	if err != nil {
-		fmt.Errorf("gateway container fail to init with error: %s", err)
-		return err
+		return fmt.Errorf("gateway container fail to init with error: %s", err)
+	}
+	for _, dep := range []string{wire.SNChat, wire.SNLogin} {
+		selector, err := container.NewSelector(config.Selectors[dep], config.Zone)
+		if err != nil {
+			return err
+		}
+		container.SetServiceSelector(dep, selector)
 	}
-	ns, err := consul.NewNaming(config.ConsulURL)
+	ns, err := conf.NewNaming(config)
 	if err != nil {
 		return err
 	}
 	container.SetServiceNaming(ns)
+	if config.MonitorPort > 0 {
+		// the registry checks readiness, so that traffic is not routed to
+		// the service before its dependencies are connected
+		service.Meta[consul.KeyHealthURL] = fmt.Sprintf("http://%s:%d%s",
+			config.PublicAddress, config.MonitorPort, container.MonitorPathReady)
+		container.SetMonitor(fmt.Sprintf(":%d", config.MonitorPort))
+	}
 	container.SetDialer(serv.NewDialer(config.ServiceID))
-	return container.Start()
+	ctx, cancel := container.WithSignal(ctx)
+	defer cancel()
+	go handler.WatchExpiry(ctx, channels, serv.DefaultExpiryInterval)
+	return container.Start(ctx)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/wangxuefeng90923/wxf"
 	"strings"
+	"time"
 )
 
 type Server struct {
@@ -22,6 +23,63 @@ type Config struct {
 	PublicPort    int `default:"8005"`
 	Tags          []string
 	ConsulURL     string
+	// RedisAddrs is the address of redis keeping sessions, it is
+	// required by logic services
+	RedisAddrs    string
+	RedisPassword string `json:"-"`
+	// NamingFile is a YAML or JSON file listing services, see naming/file
+	NamingFile string
+	// NamingDNS is the domain to resolve services by DNS SRV records, see naming/dns
+	NamingDNS         string
+	NamingDNSInterval time.Duration `default:"10s"`
+	// HealthCheck of consul is one of http, ttl and tcp, it is http by
+	// default if MonitorPort is set, which requests the readiness path
+	HealthCheck    string
+	HealthCheckTTL time.Duration `default:"15s"`
+	Zone           string
+	Weight         int `default:"1"`
+	// Selectors maps a dependent service name to its selector algorithm,
+	// e.g. chat:hashslots:dest, see container.NewSelector
+	Selectors map[string]string
+	// TraceExporter is one of "", "stdout" or "file"
+	TraceExporter string
+	TraceFile     string `default:"trace.json"`
+	// TokenSecret is the HMAC secret of tokens without kid, either of
+	// TokenSecret, TokenKeys or keys of Apps must be set
+	TokenSecret string `json:"-"`
+	// TokenKeys verify tokens by their kid, the first one able to
+	// sign is used to issue tokens
+	TokenKeys []TokenKey
+	// Revocations of tokens are kept in "consul", tokens are not checked
+	// for revocation if it is empty
+	Revocations string
+	// AdminToken authorizes admin requests on the monitor port as a
+	// bearer token, it is required if Revocations is set. logic services
+	// fail to start if either is set without MonitorPort
+	AdminToken string `json:"-"`
+	// Apps are tenants with their own token keys and features, only
+	// sessions of Apps are served by logic services if it is set
+	Apps map[string]AppConfig
+}
+
+// AppConfig of a tenant, its tokens are verified by TokenSecret and
+// TokenKeys if either is set
+type AppConfig struct {
+	TokenSecret string `json:"-"`
+	TokenKeys   []TokenKey
+	// Commands allowed in the app, all commands are allowed if empty
+	Commands []string
+	Features map[string]string
+}
+
+// TokenKey is a HS256 secret if Algorithm is empty, or a RS256/ES256
+// public key in PEM which is given inline or by file
+type TokenKey struct {
+	ID            string
+	Algorithm     string
+	Secret        string `json:"-"`
+	PublicKey     string
+	PublicKeyFile string
 }
 
 func (c Config) String() string {
@@ -0,0 +1,26 @@
+package conf
+
+import (
+	"github.com/wangxuefeng90923/wxf/naming"
+	"github.com/wangxuefeng90923/wxf/naming/consul"
+	"github.com/wangxuefeng90923/wxf/naming/dns"
+	"github.com/wangxuefeng90923/wxf/naming/file"
+)
+
+// NewNaming create the naming of config, a services file takes
+// precedence over DNS, and both of them take precedence over consul
+func NewNaming(config *Config) (naming.Naming, error) {
+	if config.NamingFile != "" {
+		return file.NewNaming(config.NamingFile)
+	}
+	if config.NamingDNS != "" {
+		return dns.NewNaming(dns.Options{
+			Domain:   config.NamingDNS,
+			Interval: config.NamingDNSInterval,
+		})
+	}
+	return consul.NewNamingWithOptions(config.ConsulURL, consul.Options{
+		Check: config.HealthCheck,
+		TTL:   config.HealthCheckTTL,
+	})
+}
@@ -0,0 +1,31 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/storage"
+	"time"
+)
+
+var ErrNoRedis = errors.New("RedisAddrs is not configured")
+
+// NewStorage creates the session storage of config, it fails if redis
+// is not configured or can not be reached
+func NewStorage(config *Config) (wxf.SessionStorage, error) {
+	if config.RedisAddrs == "" {
+		return nil, ErrNoRedis
+	}
+	cli := redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddrs,
+		Password: config.RedisPassword,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := cli.Ping(ctx).Err(); err != nil {
+		_ = cli.Close()
+		return nil, err
+	}
+	return storage.NewRedisStorage(cli), nil
+}
@@ -0,0 +1,104 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/storage"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"os"
+)
+
+var ErrNoTokenKey = errors.New("no token key is configured, set TokenSecret or TokenKeys")
+
+// ErrMemoryRevocations is returned for revocations kept in memory, they
+// are not shared by gateways and logic services
+var ErrMemoryRevocations = errors.New("memory revocations are only for tests, use consul")
+
+// NewKeyring creates the keyring verifying tokens of config, apps with
+// their own keys are verified by them only. it fails if no key is
+// configured, tokens of apps without their own keys are rejected if
+// only apps have keys
+func NewKeyring(config *Config) (*token.Keyring, error) {
+	keyring, err := newKeyring(config.TokenSecret, config.TokenKeys)
+	if err != nil {
+		return nil, err
+	}
+	configured := config.TokenSecret != "" || len(config.TokenKeys) > 0
+	for id, app := range config.Apps {
+		if app.TokenSecret == "" && len(app.TokenKeys) == 0 {
+			continue
+		}
+		appKeyring, err := newKeyring(app.TokenSecret, app.TokenKeys)
+		if err != nil {
+			return nil, fmt.Errorf("app %s: %v", id, err)
+		}
+		keyring.SetApp(id, appKeyring)
+		configured = true
+	}
+	if !configured {
+		return nil, ErrNoTokenKey
+	}
+	return keyring, nil
+}
+
+// NewRevocations creates the revocation list of config, it is nil if
+// revocations are not configured. revocations must be shared by all
+// services, so those in memory of a process are refused
+func NewRevocations(config *Config) (token.Revocations, error) {
+	switch config.Revocations {
+	case "":
+		return nil, nil
+	case "memory":
+		return nil, ErrMemoryRevocations
+	case "consul":
+		return storage.NewConsulRevocations(config.ConsulURL)
+	default:
+		return nil, fmt.Errorf("revocations %s is not supported", config.Revocations)
+	}
+}
+
+// NewApps returns the apps served by logic services
+func NewApps(config *Config) []*wxf.App {
+	apps := make([]*wxf.App, 0, len(config.Apps))
+	for id, app := range config.Apps {
+		apps = append(apps, &wxf.App{
+			ID:       id,
+			Commands: app.Commands,
+			Features: app.Features,
+		})
+	}
+	return apps
+}
+
+func newKeyring(secret string, tokenKeys []TokenKey) (*token.Keyring, error) {
+	var keys []*token.Key
+	for _, k := range tokenKeys {
+		key, err := newTokenKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("token key %s: %v", k.ID, err)
+		}
+		keys = append(keys, key)
+	}
+	if secret != "" {
+		keys = append(keys, token.NewHMACKey("", secret))
+	}
+	return token.NewKeyring(keys...), nil
+}
+
+func newTokenKey(k TokenKey) (*token.Key, error) {
+	if k.Algorithm == "" || k.Algorithm == token.AlgorithmHS256 {
+		if k.Secret == "" {
+			return nil, fmt.Errorf("secret is empty")
+		}
+		return token.NewHMACKey(k.ID, k.Secret), nil
+	}
+	pem := []byte(k.PublicKey)
+	if k.PublicKeyFile != "" {
+		var err error
+		if pem, err = os.ReadFile(k.PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	return token.NewPublicKey(k.ID, k.Algorithm, pem)
+}
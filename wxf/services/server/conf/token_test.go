@@ -0,0 +1,43 @@
+package conf
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"testing"
+	"time"
+)
+
+func TestNewKeyring(t *testing.T) {
+	_, err := NewKeyring(&Config{})
+	assert.Equal(t, ErrNoTokenKey, err)
+	_, err = NewKeyring(&Config{Apps: map[string]AppConfig{"app1": {Commands: []string{"chat.user.talk"}}}})
+	assert.Equal(t, ErrNoTokenKey, err)
+
+	keyring, err := NewKeyring(&Config{TokenSecret: "secret"})
+	assert.Nil(t, err)
+	tk, _ := token.Generate("secret", &token.Token{Account: "test1", Exp: time.Now().Add(time.Hour).Unix()})
+	_, err = keyring.Parse(tk)
+	assert.Nil(t, err)
+
+	// only apps have keys, tokens of other apps are rejected
+	keyring, err = NewKeyring(&Config{Apps: map[string]AppConfig{"app1": {TokenSecret: "secret1"}}})
+	assert.Nil(t, err)
+	tk, _ = token.Generate("secret1", &token.Token{Account: "test1", App: "app1", Exp: time.Now().Add(time.Hour).Unix()})
+	_, err = keyring.Parse(tk)
+	assert.Nil(t, err)
+	for _, app := range []string{"app1", "app2"} {
+		tk, _ = token.Generate(token.DefaultSecret, &token.Token{Account: "test1", App: app, Exp: time.Now().Add(time.Hour).Unix()})
+		_, err = keyring.Parse(tk)
+		assert.NotNil(t, err, app)
+	}
+}
+
+func TestNewRevocations(t *testing.T) {
+	revocations, err := NewRevocations(&Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, revocations)
+	_, err = NewRevocations(&Config{Revocations: "memory"})
+	assert.Equal(t, ErrMemoryRevocations, err)
+	_, err = NewRevocations(&Config{Revocations: "redis"})
+	assert.NotNil(t, err)
+}
@@ -21,6 +21,9 @@ func (h *LoginHandler) DoSysLogin(ctx wxf.Context) {
 		return
 	}
 
+	// the secret is only returned to SDK, it is not kept in session
+	secret := session.Secret
+	session.Secret = nil
 	log.Infof("do login of %v ", session.String())
 	// 2. if current account login somewhere else
 	old, err := ctx.GetLocation(session.Account, "")
@@ -41,7 +44,11 @@ func (h *LoginHandler) DoSysLogin(ctx wxf.Context) {
 	}
 	// 5. return login success msg
 	var resp = &pkt.LoginResp{
-		ChannelId: session.ChannelId,
+		ChannelId:    session.ChannelId,
+		Version:      session.Version,
+		Capabilities: session.Capabilities,
+		Secret:       secret,
+		ExpiresAt:    session.ExpiresAt,
 	}
 	_ = ctx.Resp(pkt.Status_Success, resp)
 }
@@ -56,3 +63,35 @@ func (h *LoginHandler) DoSysLogout(ctx wxf.Context) {
 	}
 	_ = ctx.Resp(pkt.Status_Success, nil)
 }
+
+// DoSysRefresh updates the expiry of session with the token refreshed,
+// the token is validated by gateway
+func (h *LoginHandler) DoSysRefresh(ctx wxf.Context) {
+	var refreshed pkt.Session
+	if err := ctx.ReadBody(&refreshed); err != nil {
+		_ = ctx.RespWithError(pkt.Status_InvalidPacketBody, err)
+		return
+	}
+	session, err := ctx.Get(ctx.Session().GetChannelId())
+	if err == wxf.ErrSessionNil {
+		_ = ctx.RespWithError(pkt.Status_SessionNotFound, err)
+		return
+	} else if err != nil {
+		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		return
+	}
+	if refreshed.Account != session.Account {
+		_ = ctx.Resp(pkt.Status_Unauthorized, &pkt.ErrorResp{Message: "account mismatch"})
+		return
+	}
+	session.ExpiresAt = refreshed.ExpiresAt
+	if err = ctx.Add(session); err != nil {
+		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		return
+	}
+	_ = ctx.Resp(pkt.Status_Success, &pkt.LoginResp{
+		ChannelId: session.ChannelId,
+		Account:   session.Account,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
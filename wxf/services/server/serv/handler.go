@@ -34,23 +34,27 @@ func (h *ServeHandler) Receive(agent wxf.Agent, payload []byte) {
 	if err != nil {
 		return
 	}
+	if !fromGateway(packet) {
+		log.Warnf("%s of channel %s is not originated by gateway", packet.Command, packet.ChannelId)
+		_ = respErr(h.dispatcher.container(), agent, packet, pkt.Status_Unauthorized)
+		return
+	}
 	var session *pkt.Session
 	if packet.Command == wire.CommandLoginSignIn {
-		server, _ := packet.GetMeta(wire.MetaDestChannels)
-		session = &pkt.Session{
-			ChannelId: packet.ChannelId,
-			GateId:    server.(string),
-			Tags:      []string{"AutoGenerated"},
-		}
+		// the session is created by gateway in body of login packet,
+		// its app is required by router before login
+		session = new(pkt.Session)
+		_ = packet.ReadBody(session)
+		session.ChannelId = packet.ChannelId
+		session.GateId, _ = packet.GetStringMeta(wire.MetaDestServer)
 	} else {
-		// TODO regarding session
-		session, err = h.cache.Get(packet.GetChannelId())
+		session, err = wxf.GetSession(h.cache, packet.GetChannelId())
 		if err != nil {
 			if err == wxf.ErrSessionNil {
-				_ = RespErr(agent, packet, pkt.Status_SessionNotFound)
+				_ = respErr(h.dispatcher.container(), agent, packet, pkt.Status_SessionNotFound)
 				return
 			} else {
-				_ = RespErr(agent, packet, pkt.Status_SystemException)
+				_ = respErr(h.dispatcher.container(), agent, packet, pkt.Status_SystemException)
 				return
 			}
 		}
@@ -62,12 +66,26 @@ func (h *ServeHandler) Receive(agent wxf.Agent, payload []byte) {
 	}
 }
 
+// fromGateway reports whether packet of gateway commands and refresh,
+// whose sessions are taken from body, is marked by gateway
+func fromGateway(packet *pkt.LogicPkt) bool {
+	if !wire.GatewayCommands[packet.Command] && packet.Command != wire.CommandLoginRefresh {
+		return true
+	}
+	_, err := packet.GetStringMeta(wire.MetaGateway)
+	return err == nil
+}
+
 func RespErr(ag wxf.Agent, p *pkt.LogicPkt, status pkt.Status) error {
+	return respErr(container.Default(), ag, p, status)
+}
+
+func respErr(ctr *container.Container, ag wxf.Agent, p *pkt.LogicPkt, status pkt.Status) error {
 	packet := pkt.NewFrom(&p.Header)
 	packet.Status = status
 	packet.Flag = pkt.Flag_Response
-	p.AddStringMeta(wire.MetaDestChannels, p.Header.ChannelId)
-	return container.Push(ag.ID(), p)
+	packet.SetStringMeta(wire.MetaDestChannels, p.Header.ChannelId)
+	return ctr.Push(ag.ID(), packet)
 }
 
 func (h *ServeHandler) Accept(conn wxf.Conn, timeout time.Duration) (string, error) {
@@ -85,17 +103,31 @@ func (h *ServeHandler) Accept(conn wxf.Conn, timeout time.Duration) (string, err
 }
 
 func NewServeHandler(r *wxf.Router, cache wxf.SessionStorage) *ServeHandler {
+	return NewServeHandlerWithContainer(r, cache, nil)
+}
+
+// NewServeHandlerWithContainer create a ServeHandler pushing messages
+// through ctr, container.Default() is used if ctr is nil
+func NewServeHandlerWithContainer(r *wxf.Router, cache wxf.SessionStorage, ctr *container.Container) *ServeHandler {
 	return &ServeHandler{
 		r:          r,
 		cache:      cache,
-		dispatcher: &ServerDispatcher{},
+		dispatcher: &ServerDispatcher{Container: ctr},
 	}
 }
 
 type ServerDispatcher struct {
+	Container *container.Container
+}
+
+func (h *ServerDispatcher) container() *container.Container {
+	if h == nil || h.Container == nil {
+		return container.Default()
+	}
+	return h.Container
 }
 
 func (h *ServerDispatcher) Push(gateway string, channels []string, p *pkt.LogicPkt) error {
-	p.AddStringMeta(wire.MetaDestChannels, strings.Join(channels, ","))
-	return container.Push(gateway, p)
+	p.SetStringMeta(wire.MetaDestChannels, strings.Join(channels, ","))
+	return h.container().Push(gateway, p)
 }
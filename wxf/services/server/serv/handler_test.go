@@ -0,0 +1,109 @@
+package serv
+
+import (
+	"bytes"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/container"
+	"github.com/wangxuefeng90923/wxf/services/server/handler"
+	"github.com/wangxuefeng90923/wxf/storage"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"testing"
+	"time"
+)
+
+// pushServer records packets pushed to gateways
+type pushServer struct {
+	wxf.Server
+	pushed []*pkt.LogicPkt
+}
+
+func (s *pushServer) Push(id string, data []byte) error {
+	p, err := pkt.MustReadLogicPkt(bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	s.pushed = append(s.pushed, p)
+	return nil
+}
+
+type gatewayAgent string
+
+func (a gatewayAgent) ID() string { return string(a) }
+
+func (a gatewayAgent) Push([]byte) error { return nil }
+
+func newTestCache(t *testing.T) wxf.SessionStorage {
+	mr := miniredis.RunT(t)
+	return storage.NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+}
+
+func TestServeHandler(t *testing.T) {
+	r := wxf.NewRouter()
+	r.SetApps(&wxf.App{ID: "wxf", Commands: []string{wire.CommandLoginSignIn, wire.CommandLoginRefresh}})
+	loginHandler := handler.NewLoginHandler()
+	r.Handle(wire.CommandLoginSignIn, loginHandler.DoSysLogin)
+	r.Handle(wire.CommandLoginRefresh, loginHandler.DoSysRefresh)
+	cache := newTestCache(t)
+	srv := &pushServer{}
+	h := NewServeHandlerWithContainer(r, cache, &container.Container{Srv: srv})
+	agent := gatewayAgent("gateway01")
+	channel := "gateway01_test1_1"
+
+	exp := time.Now().Add(time.Minute).Unix()
+	login := pkt.New(wire.CommandLoginSignIn, pkt.WithChannel(channel))
+	login.SetStringMeta(wire.MetaGateway, "gateway01")
+	login.WriteBody(&pkt.Session{ChannelId: channel, GateId: "gateway01", Account: "test1", App: "wxf", ExpiresAt: exp})
+	h.Receive(agent, pkt.Marshal(login))
+	assert.Equal(t, 1, len(srv.pushed))
+	assert.Equal(t, pkt.Status_Success, srv.pushed[0].Status)
+	// accounts are kept in the namespace of app
+	session, err := cache.Get(channel)
+	assert.Nil(t, err)
+	assert.Equal(t, "wxf:test1", session.Account)
+	assert.Equal(t, "gateway01", session.GateId)
+
+	refresh := pkt.New(wire.CommandLoginRefresh, pkt.WithChannel(channel))
+	refresh.SetStringMeta(wire.MetaGateway, "gateway01")
+	refresh.WriteBody(&pkt.Session{ChannelId: channel, Account: "test1", App: "wxf", ExpiresAt: exp + 3600})
+	h.Receive(agent, pkt.Marshal(refresh))
+	assert.Equal(t, 2, len(srv.pushed))
+	assert.Equal(t, pkt.Status_Success, srv.pushed[1].Status)
+	session, _ = cache.Get(channel)
+	assert.Equal(t, exp+3600, session.ExpiresAt)
+
+	// commands out of the app are not allowed
+	talk := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel(channel))
+	h.Receive(agent, pkt.Marshal(talk))
+	assert.Equal(t, 3, len(srv.pushed))
+	assert.Equal(t, pkt.Status_Unauthorized, srv.pushed[2].Status)
+}
+
+func TestServeHandlerForged(t *testing.T) {
+	r := wxf.NewRouter()
+	loginHandler := handler.NewLoginHandler()
+	r.Handle(wire.CommandLoginSignIn, loginHandler.DoSysLogin)
+	r.Handle(wire.CommandLoginRefresh, loginHandler.DoSysRefresh)
+	cache := newTestCache(t)
+	srv := &pushServer{}
+	h := NewServeHandlerWithContainer(r, cache, &container.Container{Srv: srv})
+	channel := "gateway01_test1_1"
+
+	// login packets without the mark of gateway are rejected
+	login := pkt.New(wire.CommandLoginSignIn, pkt.WithChannel(channel))
+	login.WriteBody(&pkt.Session{ChannelId: channel, GateId: "gateway01", Account: "test2", App: "other"})
+	h.Receive(gatewayAgent("gateway01"), pkt.Marshal(login))
+	assert.Equal(t, 1, len(srv.pushed))
+	assert.Equal(t, pkt.Status_Unauthorized, srv.pushed[0].Status)
+	_, err := cache.Get(channel)
+	assert.Equal(t, wxf.ErrSessionNil, err)
+
+	refresh := pkt.New(wire.CommandLoginRefresh, pkt.WithChannel(channel))
+	refresh.WriteBody(&pkt.Session{ChannelId: channel, Account: "test2", App: "other"})
+	h.Receive(gatewayAgent("gateway01"), pkt.Marshal(refresh))
+	assert.Equal(t, 2, len(srv.pushed))
+	assert.Equal(t, pkt.Status_Unauthorized, srv.pushed[1].Status)
+}
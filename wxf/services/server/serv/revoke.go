@@ -0,0 +1,131 @@
+package serv
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PathRevoke is the admin path on monitor to revoke tokens, it accepts
+// POST with form of jti and exp, or app and account to revoke tokens of
+// the account and kick out its sessions. the admin token is required in
+// header Authorization as "Bearer <token>"
+const PathRevoke = "/admin/revoke"
+
+var (
+	ErrNoAdminToken = errors.New("admin token is not configured")
+	errNoStorage    = errors.New("session storage is not set")
+)
+
+// RevokeHandler revokes tokens and kicks out sessions
+type RevokeHandler struct {
+	Revocations token.Revocations
+	// AdminToken authorizes requests, all of them are refused if it is empty
+	AdminToken string
+	cache      wxf.SessionStorage
+	dispatcher wxf.Dispatcher
+}
+
+// RevokeHandler returns the admin handler of h with revocations, it
+// fails if adminToken is empty
+func (h *ServeHandler) RevokeHandler(revocations token.Revocations, adminToken string) (*RevokeHandler, error) {
+	if adminToken == "" {
+		return nil, ErrNoAdminToken
+	}
+	return &RevokeHandler{
+		Revocations: revocations,
+		AdminToken:  adminToken,
+		cache:       h.cache,
+		dispatcher:  h.dispatcher,
+	}, nil
+}
+
+func (h *RevokeHandler) authorized(r *http.Request) bool {
+	if h.AdminToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(h.AdminToken)) == 1
+}
+
+func (h *RevokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if id := r.FormValue("jti"); id != "" {
+		exp, err := strconv.ParseInt(r.FormValue("exp"), 10, 64)
+		if err != nil {
+			http.Error(w, "exp is invalid", http.StatusBadRequest)
+			return
+		}
+		if err = h.Revocations.RevokeID(id, exp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+		return
+	}
+	account := r.FormValue("account")
+	if account == "" {
+		http.Error(w, "jti or account is required", http.StatusBadRequest)
+		return
+	}
+	kicked, err := h.RevokeAccount(r.FormValue("app"), account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%d", kicked)
+}
+
+// RevokeAccount revokes tokens of account issued until now, and kicks
+// out its active sessions, it returns the count of sessions kicked out.
+// iat of tokens is in seconds, so the revocation is recorded at the next
+// second to cover tokens issued in the current one
+func (h *RevokeHandler) RevokeAccount(app, account string) (int, error) {
+	if err := h.Revocations.RevokeAccount(app, account, time.Now().Unix()+1); err != nil {
+		return 0, err
+	}
+	return h.Kickout(app, account)
+}
+
+// Kickout notifies all sessions of account to sign out with
+// KickoutNotify, and deletes them from session storage
+func (h *RevokeHandler) Kickout(app, account string) (int, error) {
+	if h.cache == nil {
+		return 0, errNoStorage
+	}
+	cache := wxf.NewAppStorage(h.cache, app)
+	locs, err := wxf.ListLocations(cache, account)
+	if err != nil && err != wxf.ErrSessionNil {
+		return 0, err
+	}
+	for _, loc := range locs {
+		p := pkt.New(wire.CommandLoginKickout)
+		p.Flag = pkt.Flag_Push
+		p.WriteBody(&pkt.KickoutNotify{ChannelId: loc.ChannelId})
+		if err = h.dispatcher.Push(loc.GateId, []string{loc.ChannelId}, p); err != nil {
+			log.Warn(err)
+		}
+		if err = cache.Delete(account, loc.ChannelId); err != nil {
+			return 0, err
+		}
+	}
+	return len(locs), nil
+}
@@ -0,0 +1,143 @@
+package serv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/container"
+	"github.com/wangxuefeng90923/wxf/services/server/handler"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// locationStorage keeps locations of accounts in memory
+type locationStorage struct {
+	wxf.SessionStorage
+	locations map[string][]*wxf.Location
+}
+
+func (s *locationStorage) GetLocations(accounts ...string) ([]*wxf.Location, error) {
+	var locs []*wxf.Location
+	for _, account := range accounts {
+		locs = append(locs, s.locations[account]...)
+	}
+	return locs, nil
+}
+
+func (s *locationStorage) Delete(account string, channelId string) error {
+	delete(s.locations, account)
+	return nil
+}
+
+type pushDispatcher struct {
+	pushed []*pkt.LogicPkt
+}
+
+func (d *pushDispatcher) Push(gateway string, channels []string, p *pkt.LogicPkt) error {
+	d.pushed = append(d.pushed, p)
+	return nil
+}
+
+func TestRevokeAccount(t *testing.T) {
+	revocations := token.NewMemoryRevocations()
+	dispatcher := new(pushDispatcher)
+	cache := &locationStorage{locations: map[string][]*wxf.Location{
+		"wxf:test1": {{ChannelId: "ch1", GateId: "gateway01"}, {ChannelId: "ch2", GateId: "gateway02"}},
+	}}
+	h := &RevokeHandler{Revocations: revocations, AdminToken: "admin", cache: cache, dispatcher: dispatcher}
+	request := func(method, target, adminToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if adminToken != "" {
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	form := url.Values{"app": {"wxf"}, "account": {"test1"}}
+	w := request(http.MethodPost, PathRevoke+"?"+form.Encode(), "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = request(http.MethodPost, PathRevoke+"?"+form.Encode(), "other")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 0, len(dispatcher.pushed))
+
+	w = request(http.MethodPost, PathRevoke+"?"+form.Encode(), "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Body.String())
+
+	assert.Equal(t, 2, len(dispatcher.pushed))
+	var notify pkt.KickoutNotify
+	assert.Nil(t, dispatcher.pushed[1].ReadBody(&notify))
+	assert.Equal(t, "ch2", notify.ChannelId)
+	assert.Equal(t, wire.CommandLoginKickout, dispatcher.pushed[1].Command)
+	assert.Equal(t, 0, len(cache.locations))
+
+	revoked, _ := revocations.Revoked(&token.Token{Account: "test1", App: "wxf", IssuedAt: time.Now().Unix() - 1})
+	assert.True(t, revoked)
+	// tokens issued in the second of revocation are revoked too
+	revoked, _ = revocations.Revoked(&token.Token{Account: "test1", App: "wxf", IssuedAt: time.Now().Unix()})
+	assert.True(t, revoked)
+
+	w = request(http.MethodPost, PathRevoke+"?jti=t1&exp=x", "admin")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request(http.MethodGet, PathRevoke, "admin")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	// all requests are refused without admin token
+	h.AdminToken = ""
+	w = request(http.MethodPost, PathRevoke+"?"+form.Encode(), "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRevokeKickout(t *testing.T) {
+	r := wxf.NewRouter()
+	loginHandler := handler.NewLoginHandler()
+	r.Handle(wire.CommandLoginSignIn, loginHandler.DoSysLogin)
+	cache := newTestCache(t)
+	srv := &pushServer{}
+	h := NewServeHandlerWithContainer(r, cache, &container.Container{Srv: srv})
+	login := func(gateway, channel, app string) {
+		p := pkt.New(wire.CommandLoginSignIn, pkt.WithChannel(channel))
+		p.SetStringMeta(wire.MetaGateway, gateway)
+		p.WriteBody(&pkt.Session{ChannelId: channel, GateId: gateway, Account: "test1", App: app})
+		h.Receive(gatewayAgent(gateway), pkt.Marshal(p))
+		_, err := cache.Get(channel)
+		assert.Nil(t, err)
+	}
+	// sessions of the account on two devices, and of another app
+	login("gateway01", "gateway01_test1_1", "wxf")
+	login("gateway02", "gateway02_test1_2", "wxf")
+	login("gateway02", "gateway02_test1_3", "other")
+
+	_, err := h.RevokeHandler(token.NewMemoryRevocations(), "")
+	assert.Equal(t, ErrNoAdminToken, err)
+	revokeHandler, err := h.RevokeHandler(token.NewMemoryRevocations(), "admin")
+	assert.Nil(t, err)
+	pushed := len(srv.pushed)
+	kicked, err := revokeHandler.RevokeAccount("wxf", "test1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, kicked)
+	var kickouts []string
+	for _, p := range srv.pushed[pushed:] {
+		assert.Equal(t, wire.CommandLoginKickout, p.Command)
+		var notify pkt.KickoutNotify
+		assert.Nil(t, p.ReadBody(&notify))
+		kickouts = append(kickouts, notify.ChannelId)
+	}
+	assert.ElementsMatch(t, []string{"gateway01_test1_1", "gateway02_test1_2"}, kickouts)
+
+	for _, channel := range kickouts {
+		_, err = cache.Get(channel)
+		assert.Equal(t, wxf.ErrSessionNil, err)
+	}
+	_, err = cache.GetLocation("wxf:test1", "")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+	_, err = cache.Get("gateway02_test1_3")
+	assert.Nil(t, err)
+}
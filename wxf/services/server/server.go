@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/wangxuefeng90923/wxf"
 	"github.com/wangxuefeng90923/wxf/container"
@@ -11,7 +12,9 @@ import (
 	"github.com/wangxuefeng90923/wxf/services/server/handler"
 	"github.com/wangxuefeng90923/wxf/services/server/serv"
 	"github.com/wangxuefeng90923/wxf/tcp"
+	"github.com/wangxuefeng90923/wxf/tracing"
 	"github.com/wangxuefeng90923/wxf/wire"
+	"strconv"
 )
 
 type ServerStartOptions struct {
@@ -26,15 +29,21 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	}
 	level, _ := logrus.ParseLevel("trace")
 	logrus.SetLevel(level)
+	shutdownTracing, err := tracing.Init(opts.serviceName, config.TraceExporter, config.TraceFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
 
 	r := wxf.NewRouter()
+	r.SetApps(conf.NewApps(config)...)
 
 	loginHandler := handler.NewLoginHandler()
 	r.Handle(wire.CommandLoginSignIn, loginHandler.DoSysLogin)
 	r.Handle(wire.CommandLoginSignOut, loginHandler.DoSysLogout)
-
-	// TODO: init Redis
-	// TODO: session management
+	r.Handle(wire.CommandLoginRefresh, loginHandler.DoSysRefresh)
 
 	service := &naming.DefaultService{
 		Id:       config.ServiceID,
@@ -43,9 +52,17 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 		Port:     config.PublicPort,
 		Protocol: string(wire.ProtocolTCP),
 		Tags:     config.Tags,
+		Meta: map[string]string{
+			container.KeyServiceZone:   config.Zone,
+			container.KeyServiceWeight: strconv.Itoa(config.Weight),
+		},
 	}
 
-	servHandler := &serv.ServeHandler{}
+	cache, err := conf.NewStorage(config)
+	if err != nil {
+		return err
+	}
+	servHandler := serv.NewServeHandler(r, cache)
 
 	srv := tcp.NewServer(config.Listen, service)
 	srv.SetReadWait(wxf.DefaultReadWait)
@@ -57,11 +74,38 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 		return err
 	}
 
-	ns, err := consul.NewNaming(config.ConsulURL)
+	ns, err := conf.NewNaming(config)
 	if err != nil {
 		return err
 	}
 	container.SetServiceNaming(ns)
+	// the admin endpoint is served on the monitor port only
+	revocations, err := conf.NewRevocations(config)
+	if err != nil {
+		return err
+	}
+	if (revocations != nil || config.AdminToken != "") && config.MonitorPort <= 0 {
+		return fmt.Errorf("MonitorPort is required to serve %s", serv.PathRevoke)
+	}
+	if config.MonitorPort > 0 {
+		// the registry checks readiness, so that traffic is not routed to
+		// the service before its dependencies are connected
+		service.Meta[consul.KeyHealthURL] = fmt.Sprintf("http://%s:%d%s",
+			config.PublicAddress, config.MonitorPort, container.MonitorPathReady)
+		container.SetMonitor(fmt.Sprintf(":%d", config.MonitorPort))
+		if revocations != nil {
+			revokeHandler, err := servHandler.RevokeHandler(revocations, config.AdminToken)
+			if err != nil {
+				return err
+			}
+			container.HandleMonitor(serv.PathRevoke, revokeHandler)
+			logrus.Infof("%s is served on monitor port %d", serv.PathRevoke, config.MonitorPort)
+		} else {
+			logrus.Infof("%s is not served as revocations are not configured", serv.PathRevoke)
+		}
+	}
 
-	return container.Start()
+	ctx, cancel := container.WithSignal(ctx)
+	defer cancel()
+	return container.Start(ctx)
 }
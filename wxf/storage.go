@@ -14,3 +14,19 @@ type SessionStorage interface {
 	GetLocations(account ...string) ([]*Location, error)
 	GetLocation(account string, device string) (*Location, error)
 }
+
+// SessionLister is implemented by SessionStorage keeping all sessions
+// of an account, rather than the location of its latest login only
+type SessionLister interface {
+	// ListLocations returns locations of all sessions of account
+	ListLocations(account string) ([]*Location, error)
+}
+
+// ListLocations returns locations of all sessions of account if storage
+// is a SessionLister, or the location of its latest login otherwise
+func ListLocations(storage SessionStorage, account string) ([]*Location, error) {
+	if lister, ok := storage.(SessionLister); ok {
+		return lister.ListLocations(account)
+	}
+	return storage.GetLocations(account)
+}
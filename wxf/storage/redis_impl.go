@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
 	"github.com/wangxuefeng90923/wxf"
 	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"google.golang.org/protobuf/proto"
 	"time"
 )
 
@@ -10,30 +14,192 @@ const (
 	LocationExpired = time.Hour * 48
 )
 
+// RedisStorage keeps sessions and locations of accounts in redis, so
+// that they are shared by all logic services
 type RedisStorage struct {
+	cli *redis.Client
+}
+
+func NewRedisStorage(cli *redis.Client) wxf.SessionStorage {
+	return &RedisStorage{cli: cli}
+}
+
+// KeySession is the key of session of channelId
+func KeySession(channelId string) string {
+	return "login:sn:" + channelId
+}
+
+// KeySessions is the key of channelIds of all sessions of account
+func KeySessions(account string) string {
+	return "login:chs:" + account
+}
+
+// KeyLocation is the key of location of account on device, the location
+// of the latest login is kept if device is empty
+func KeyLocation(account, device string) string {
+	if device == "" {
+		return "login:loc:" + account
+	}
+	return "login:loc:" + account + ":" + device
 }
 
 func (r *RedisStorage) Add(session *pkt.Session) error {
-	//TODO implement me
-	panic("implement me")
+	ctx := context.Background()
+	loc, err := json.Marshal(&wxf.Location{
+		ChannelId: session.ChannelId,
+		GateId:    session.GateId,
+	})
+	if err != nil {
+		return err
+	}
+	sn, err := proto.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = r.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, KeyLocation(session.Account, ""), loc, LocationExpired)
+		p.Set(ctx, KeySession(session.ChannelId), sn, LocationExpired)
+		p.SAdd(ctx, KeySessions(session.Account), session.ChannelId)
+		p.Expire(ctx, KeySessions(session.Account), LocationExpired)
+		return nil
+	})
+	return err
 }
 
-func (r *RedisStorage) Delete(account string, channleId string) error {
-	//TODO implement me
-	panic("implement me")
+// Delete the session of channelId, the location of account is kept if
+// it is of another channel which logged in later
+func (r *RedisStorage) Delete(account string, channelId string) error {
+	ctx := context.Background()
+	key := KeyLocation(account, "")
+	err := r.cli.Watch(ctx, func(tx *redis.Tx) error {
+		loc, err := getLocation(ctx, tx, key)
+		if err == wxf.ErrSessionNil || err == nil && loc.ChannelId != channelId {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return err
+	}
+	_, err = r.cli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, KeySession(channelId))
+		p.SRem(ctx, KeySessions(account), channelId)
+		return nil
+	})
+	return err
 }
 
 func (r *RedisStorage) Get(channelId string) (*pkt.Session, error) {
-	//TODO implement me
-	panic("implement me")
+	bts, err := r.cli.Get(context.Background(), KeySession(channelId)).Bytes()
+	if err == redis.Nil {
+		return nil, wxf.ErrSessionNil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session pkt.Session
+	if err = proto.Unmarshal(bts, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetLocations of accounts online, it returns ErrSessionNil if none of
+// them is online
+func (r *RedisStorage) GetLocations(accounts ...string) ([]*wxf.Location, error) {
+	if len(accounts) == 0 {
+		return nil, wxf.ErrSessionNil
+	}
+	keys := make([]string, len(accounts))
+	for i, account := range accounts {
+		keys[i] = KeyLocation(account, "")
+	}
+	values, err := r.cli.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*wxf.Location, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var loc wxf.Location
+		if err = json.Unmarshal([]byte(s), &loc); err != nil {
+			return nil, err
+		}
+		locations = append(locations, &loc)
+	}
+	if len(locations) == 0 {
+		return nil, wxf.ErrSessionNil
+	}
+	return locations, nil
 }
 
-func (r *RedisStorage) GetLocations(account ...string) ([]*wxf.Location, error) {
-	//TODO implement me
-	panic("implement me")
+// ListLocations implements wxf.SessionLister, channels whose sessions
+// expired are removed from sessions of account
+func (r *RedisStorage) ListLocations(account string) ([]*wxf.Location, error) {
+	ctx := context.Background()
+	channels, err := r.cli.SMembers(ctx, KeySessions(account)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, wxf.ErrSessionNil
+	}
+	keys := make([]string, len(channels))
+	for i, channelId := range channels {
+		keys[i] = KeySession(channelId)
+	}
+	values, err := r.cli.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*wxf.Location, 0, len(values))
+	var expired []interface{}
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			expired = append(expired, channels[i])
+			continue
+		}
+		var session pkt.Session
+		if err = proto.Unmarshal([]byte(s), &session); err != nil {
+			return nil, err
+		}
+		locations = append(locations, &wxf.Location{ChannelId: session.ChannelId, GateId: session.GateId})
+	}
+	if len(expired) > 0 {
+		_ = r.cli.SRem(ctx, KeySessions(account), expired...).Err()
+	}
+	if len(locations) == 0 {
+		return nil, wxf.ErrSessionNil
+	}
+	return locations, nil
 }
 
 func (r *RedisStorage) GetLocation(account string, device string) (*wxf.Location, error) {
-	//TODO implement me
-	panic("implement me")
+	return getLocation(context.Background(), r.cli, KeyLocation(account, device))
+}
+
+func getLocation(ctx context.Context, cmd redis.Cmdable, key string) (*wxf.Location, error) {
+	bts, err := cmd.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, wxf.ErrSessionNil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var loc wxf.Location
+	if err = json.Unmarshal(bts, &loc); err != nil {
+		return nil, err
+	}
+	return &loc, nil
 }
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"testing"
+)
+
+func newTestStorage(t *testing.T) wxf.SessionStorage {
+	mr := miniredis.RunT(t)
+	return NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+}
+
+func TestRedisStorage(t *testing.T) {
+	cache := newTestStorage(t)
+	_, err := cache.Get("gateway01_test1_1")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+	_, err = cache.GetLocation("test1", "")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+
+	err = cache.Add(&pkt.Session{ChannelId: "gateway01_test1_1", GateId: "gateway01", Account: "test1", App: "wxf"})
+	assert.Nil(t, err)
+	session, err := cache.Get("gateway01_test1_1")
+	assert.Nil(t, err)
+	assert.Equal(t, "test1", session.Account)
+	assert.Equal(t, "wxf", session.App)
+	loc, err := cache.GetLocation("test1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, &wxf.Location{ChannelId: "gateway01_test1_1", GateId: "gateway01"}, loc)
+
+	_ = cache.Add(&pkt.Session{ChannelId: "gateway02_test2_2", GateId: "gateway02", Account: "test2"})
+	locs, err := cache.GetLocations("test1", "none", "test2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(locs))
+	assert.Equal(t, "gateway02", locs[1].GateId)
+	_, err = cache.GetLocations("none")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+
+	// the location of a later login is kept when the old channel logs out
+	_ = cache.Add(&pkt.Session{ChannelId: "gateway02_test1_3", GateId: "gateway02", Account: "test1"})
+	assert.Nil(t, cache.Delete("test1", "gateway01_test1_1"))
+	_, err = cache.Get("gateway01_test1_1")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+	loc, err = cache.GetLocation("test1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "gateway02_test1_3", loc.ChannelId)
+
+	assert.Nil(t, cache.Delete("test1", "gateway02_test1_3"))
+	_, err = cache.GetLocation("test1", "")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+}
+
+func TestRedisStorageListLocations(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	lister, ok := cache.(wxf.SessionLister)
+	assert.True(t, ok)
+	_, err := lister.ListLocations("test1")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+
+	_ = cache.Add(&pkt.Session{ChannelId: "gateway01_test1_1", GateId: "gateway01", Account: "test1"})
+	_ = cache.Add(&pkt.Session{ChannelId: "gateway02_test1_2", GateId: "gateway02", Account: "test1"})
+	_ = cache.Add(&pkt.Session{ChannelId: "gateway02_test2_3", GateId: "gateway02", Account: "test2"})
+	locs, err := lister.ListLocations("test1")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []*wxf.Location{
+		{ChannelId: "gateway01_test1_1", GateId: "gateway01"},
+		{ChannelId: "gateway02_test1_2", GateId: "gateway02"},
+	}, locs)
+
+	// channels of expired sessions are dropped
+	mr.Del(KeySession("gateway01_test1_1"))
+	locs, err = lister.ListLocations("test1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locs))
+	members, _ := mr.SMembers(KeySessions("test1"))
+	assert.Equal(t, []string{"gateway02_test1_2"}, members)
+
+	assert.Nil(t, cache.Delete("test1", "gateway02_test1_2"))
+	_, err = lister.ListLocations("test1")
+	assert.Equal(t, wxf.ErrSessionNil, err)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"strconv"
+	"time"
+)
+
+// RevocationPrefix of keys in consul KV
+const RevocationPrefix = "wxf/revocations/"
+
+// ConsulRevocations keeps revocations in consul KV, so that they are
+// shared by gateways and the admin of logic services
+type ConsulRevocations struct {
+	kv *api.KV
+}
+
+func NewConsulRevocations(consulUrl string) (*ConsulRevocations, error) {
+	conf := api.DefaultConfig()
+	conf.Address = consulUrl
+	cli, err := api.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulRevocations{kv: cli.KV()}, nil
+}
+
+func idKey(id string) string {
+	return RevocationPrefix + "id/" + id
+}
+
+func accountKey(app, account string) string {
+	return fmt.Sprintf("%saccount/%s/%s", RevocationPrefix, app, account)
+}
+
+// RevokeID keeps the revocation until exp, expired revocations of token
+// ID are dropped when new ones are added
+func (c *ConsulRevocations) RevokeID(id string, exp int64) error {
+	_, err := c.kv.Put(&api.KVPair{
+		Key:   idKey(id),
+		Value: []byte(strconv.FormatInt(exp, 10)),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	return c.prune(time.Now().Unix())
+}
+
+// prune deletes revocations of token ID expired before now, those put
+// again after they are listed are kept by check-and-set
+func (c *ConsulRevocations) prune(now int64) error {
+	pairs, _, err := c.kv.List(idKey(""), nil)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		exp, err := strconv.ParseInt(string(pair.Value), 10, 64)
+		if err != nil || exp >= now {
+			continue
+		}
+		if _, _, err = c.kv.DeleteCAS(pair, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeAccount keeps the latest revocation of account by check-and-set
+func (c *ConsulRevocations) RevokeAccount(app, account string, before int64) error {
+	key := accountKey(app, account)
+	for {
+		pair, _, err := c.kv.Get(key, nil)
+		if err != nil {
+			return err
+		}
+		var index uint64
+		if pair != nil {
+			index = pair.ModifyIndex
+			if v, _ := strconv.ParseInt(string(pair.Value), 10, 64); v >= before {
+				return nil
+			}
+		}
+		ok, _, err := c.kv.CAS(&api.KVPair{
+			Key:         key,
+			Value:       []byte(strconv.FormatInt(before, 10)),
+			ModifyIndex: index,
+		}, nil)
+		if err != nil || ok {
+			return err
+		}
+	}
+}
+
+func (c *ConsulRevocations) Revoked(tk *token.Token) (bool, error) {
+	if tk.ID != "" {
+		pair, _, err := c.kv.Get(idKey(tk.ID), nil)
+		if err != nil {
+			return false, err
+		}
+		if pair != nil {
+			return true, nil
+		}
+	}
+	pair, _, err := c.kv.Get(accountKey(tk.App, tk.Account), nil)
+	if err != nil || pair == nil {
+		return false, err
+	}
+	before, err := strconv.ParseInt(string(pair.Value), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return token.RevokedBefore(tk, before), nil
+}
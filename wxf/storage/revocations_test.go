@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire/token"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kvStub serves /v1/kv/ of consul with check-and-set and recursive get
+type kvStub struct {
+	sync.Mutex
+	index uint64
+	pairs map[string]*api.KVPair
+}
+
+func (s *kvStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		if _, ok := r.URL.Query()["recurse"]; ok {
+			pairs := make([]*api.KVPair, 0)
+			for k, pair := range s.pairs {
+				if strings.HasPrefix(k, key) {
+					pairs = append(pairs, pair)
+				}
+			}
+			_ = json.NewEncoder(w).Encode(pairs)
+			return
+		}
+		pair, ok := s.pairs[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]*api.KVPair{pair})
+	case http.MethodPut:
+		if cas := r.URL.Query().Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			old, ok := s.pairs[key]
+			if index == 0 && ok || index != 0 && (!ok || old.ModifyIndex != index) {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		value, _ := io.ReadAll(r.Body)
+		s.index++
+		s.pairs[key] = &api.KVPair{Key: key, Value: value, ModifyIndex: s.index}
+		_, _ = w.Write([]byte("true"))
+	case http.MethodDelete:
+		if cas := r.URL.Query().Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if old, ok := s.pairs[key]; !ok || old.ModifyIndex != index {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		delete(s.pairs, key)
+		_, _ = w.Write([]byte("true"))
+	}
+}
+
+func TestConsulRevocations(t *testing.T) {
+	srv := httptest.NewServer(&kvStub{pairs: map[string]*api.KVPair{}})
+	defer srv.Close()
+	r, err := NewConsulRevocations(srv.URL)
+	assert.Nil(t, err)
+
+	now := time.Now().Unix()
+	tk := &token.Token{ID: "t1", Account: "test1", App: "wxf", IssuedAt: now - 10}
+	revoked, err := r.Revoked(tk)
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+
+	assert.Nil(t, r.RevokeID("t1", now+60))
+	revoked, _ = r.Revoked(tk)
+	assert.True(t, revoked)
+
+	assert.Nil(t, r.RevokeAccount("wxf", "test1", now-5))
+	assert.Nil(t, r.RevokeAccount("wxf", "test1", now-100))
+	revoked, err = r.Revoked(&token.Token{ID: "t2", Account: "test1", App: "wxf", IssuedAt: now - 10})
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+	revoked, _ = r.Revoked(&token.Token{ID: "t3", Account: "test1", App: "wxf", IssuedAt: now})
+	assert.False(t, revoked)
+	revoked, _ = r.Revoked(&token.Token{ID: "t3", Account: "test1", App: "wxf", IssuedAt: now - 5})
+	assert.True(t, revoked)
+}
+
+func TestConsulRevocationsPrune(t *testing.T) {
+	stub := &kvStub{pairs: map[string]*api.KVPair{}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+	r, err := NewConsulRevocations(srv.URL)
+	assert.Nil(t, err)
+
+	now := time.Now().Unix()
+	assert.Nil(t, r.RevokeAccount("wxf", "test1", now-100))
+	assert.Nil(t, r.RevokeID("t1", now-1))
+	assert.Nil(t, r.RevokeID("t2", now+60))
+	assert.Nil(t, r.RevokeID("t3", now+60))
+	stub.Lock()
+	_, ok := stub.pairs[idKey("t1")]
+	assert.False(t, ok)
+	assert.Equal(t, 3, len(stub.pairs))
+	stub.Unlock()
+
+	revoked, err := r.Revoked(&token.Token{ID: "t2"})
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+	// revocations of accounts are not pruned
+	revoked, _ = r.Revoked(&token.Token{Account: "test1", App: "wxf", IssuedAt: now - 200})
+	assert.True(t, revoked)
+}
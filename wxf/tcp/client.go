@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/wangxuefeng90923/wxf"
-	"net/url"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -55,7 +55,7 @@ func NewClientWithProps(id, name string, meta map[string]string, opts ClientOpti
 }
 
 func (c *Client) Connect(addr string) error {
-	_, err := url.Parse(addr)
+	_, _, err := net.SplitHostPort(addr)
 	if err != nil {
 		return err
 	}
@@ -130,7 +130,7 @@ func (c *Client) heartbeatLoop() error {
 
 func (c *Client) ping() error {
 	logrus.WithField("module", "tcp client").
-		Trace("%s send ping to server", c.id)
+		Tracef("%s send ping to server", c.id)
 	err := c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
 	if err != nil {
 		return err
@@ -150,6 +150,20 @@ func (c *Client) Name() string {
 	return c.name
 }
 
+// ServiceID ServiceName and GetMeta make a client created by
+// NewClientWithProps a wxf.Service, so that it can be selected
+func (c *Client) ServiceID() string {
+	return c.id
+}
+
+func (c *Client) ServiceName() string {
+	return c.name
+}
+
+func (c *Client) GetMeta() map[string]string {
+	return c.Meta
+}
+
 func (c *Client) Close() {
 	c.Do(func() {
 		if c.conn == nil {
@@ -55,6 +55,14 @@ func (c *ConnTCP) WriteFrame(code wxf.OpCode, payload []byte) error {
 	return WriteFrame(c.Conn, code, payload)
 }
 
+// PrepareFrame implements wxf.FramePreparer
+func (c *ConnTCP) PrepareFrame(code wxf.OpCode, payload []byte) ([]byte, error) {
+	data := make([]byte, 0, len(payload)+5)
+	data = append(data, byte(code))
+	data = endian.Default.AppendUint32(data, uint32(len(payload)))
+	return append(data, payload...), nil
+}
+
 func (c *ConnTCP) Flush() error {
 	panic("implement me")
 }
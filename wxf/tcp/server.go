@@ -7,13 +7,7 @@ import (
 	"github.com/segmentio/ksuid"
 	"github.com/sirupsen/logrus"
 	"github.com/wangxuefeng90923/wxf"
-	"github.com/wangxuefeng90923/wxf/container"
-	"github.com/wangxuefeng90923/wxf/naming"
-	"github.com/wangxuefeng90923/wxf/naming/consul"
-	"github.com/wangxuefeng90923/wxf/services/gateway/serv"
-	"github.com/wangxuefeng90923/wxf/services/server/conf"
-	"github.com/wangxuefeng90923/wxf/websocket"
-	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/metrics"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -30,6 +24,8 @@ type Server struct {
 	sync.Once
 	options ServerOptions
 	quit    int32
+	lock    sync.Mutex
+	lst     net.Listener
 }
 
 func NewServer(listen string, service wxf.ServiceRegistration) wxf.Server {
@@ -44,47 +40,6 @@ func NewServer(listen string, service wxf.ServiceRegistration) wxf.Server {
 	}
 }
 
-type ServerStartOptions struct {
-	config      string
-	serviceName string
-	protocol    string
-}
-
-func RunServerStart(ctx context.Context, opts *ServerStartOptions, version string) error {
-	config, err := conf.Init(opts.config)
-	if err != nil {
-		return err
-	}
-	handler := &serv.Handler{ServiceID: config.ServiceID}
-
-	var srv wxf.Server
-	service := &naming.DefaultService{
-		Id:       config.ServiceID,
-		Name:     opts.serviceName,
-		Address:  config.PublicAddress,
-		Port:     config.PublicPort,
-		Protocol: opts.protocol,
-		Tags:     config.Tags,
-	}
-	if opts.protocol == "ws" {
-		srv = websocket.NewServer(config.Listen, service)
-	}
-	srv.SetReadWait(time.Minute * 2)
-	srv.SetAcceptor(handler)
-	srv.SetMessageListener(handler)
-	srv.SetStateListener(handler)
-
-	_ = container.Init(srv, wire.SNChat, wire.SNLogin)
-	ns, err := consul.NewNaming(config.ConsulURL)
-	if err != nil {
-		return err
-	}
-	container.SetServiceNaming(ns)
-	container.SetDialer(serv.NewDialer(config.ServiceID))
-
-	return container.Start()
-}
-
 func (s *Server) Start() error {
 	log := logrus.WithFields(logrus.Fields{
 		"module": "tcp.server",
@@ -102,15 +57,29 @@ func (s *Server) Start() error {
 		s.ChannelMap = wxf.NewChannels(100)
 	}
 
+	if atomic.LoadInt32(&s.quit) == 1 {
+		return wxf.ErrServerClosed
+	}
 	lst, err := net.Listen("tcp", s.listen)
 	if err != nil {
 		return err
 	}
+	// Shutdown may run while listening, it sets quit before the lock
+	s.lock.Lock()
+	if atomic.LoadInt32(&s.quit) == 1 {
+		s.lock.Unlock()
+		_ = lst.Close()
+		return wxf.ErrServerClosed
+	}
+	s.lst = lst
+	s.lock.Unlock()
 	log.Info("tcp started")
 	for {
 		rawConn, err := lst.Accept()
 		if err != nil {
-			_ = rawConn.Close()
+			if atomic.LoadInt32(&s.quit) == 1 {
+				return nil
+			}
 			log.Warn(err)
 			return err
 		}
@@ -118,10 +87,12 @@ func (s *Server) Start() error {
 			conn := NewConn(rawConn)
 			id, err := s.Accept(conn, s.options.loginWait)
 			if err != nil {
+				metrics.HandshakeTotal.WithLabelValues(s.ServiceID(), s.ServiceName(), metrics.HandshakeRejected).Inc()
 				_ = conn.WriteFrame(wxf.OpClose, []byte(err.Error()))
 				_ = conn.Close()
 				return
 			}
+			metrics.HandshakeTotal.WithLabelValues(s.ServiceID(), s.ServiceName(), metrics.HandshakeAccepted).Inc()
 			if _, ok := s.Get(id); ok {
 				log.Warnf("channel %s existed", id)
 				_ = conn.WriteFrame(wxf.OpClose, []byte("channelId is repeated"))
@@ -131,19 +102,33 @@ func (s *Server) Start() error {
 			channel := wxf.NewChannel(id, conn)
 			channel.SetReadWait(s.options.readWait)
 			channel.SetWriteWait(s.options.writeWait)
+			if negotiator, ok := s.Acceptor.(wxf.FrameNegotiator); ok {
+				channel.SetFrameEncoder(negotiator.FrameEncoder(id))
+				channel.SetMaxFrameSize(negotiator.MaxFrameSize(id))
+			}
 			s.Add(channel)
+			gauge := metrics.ChannelTotalGauge.WithLabelValues(s.ServiceID(), s.ServiceName())
+			gauge.Inc()
 			log.Info("accept channel: ", channel)
 			err = channel.Readloop(s.MessageListener)
 			if err != nil {
 				log.Info(err)
 			}
 			s.Remove(channel.ID())
+			gauge.Dec()
 			_ = s.Disconnect(channel.ID())
 			channel.Close()
 		}(rawConn)
 	}
 }
 
+// Listening reports whether the server is accepting connections
+func (s *Server) Listening() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lst != nil && atomic.LoadInt32(&s.quit) == 0
+}
+
 func (s *Server) Push(id string, data []byte) error {
 	ch, ok := s.Get(id)
 	if !ok {
@@ -152,6 +137,14 @@ func (s *Server) Push(id string, data []byte) error {
 	return ch.Push(data)
 }
 
+func (s *Server) PushFrame(id string, frame *wxf.PreparedFrame) error {
+	ch, ok := s.Get(id)
+	if !ok {
+		return errors.New("channel not found")
+	}
+	return ch.PushFrame(frame)
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	log := logrus.WithFields(logrus.Fields{
 		"module": s.ServiceName(),
@@ -165,6 +158,14 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		if !atomic.CompareAndSwapInt32(&s.quit, 0, 1) {
 			return
 		}
+		s.lock.Lock()
+		if s.lst != nil {
+			_ = s.lst.Close()
+		}
+		s.lock.Unlock()
+		if s.ChannelMap == nil {
+			return
+		}
 		channels := s.All()
 		for _, ch := range channels {
 			_ = ch.Close()
@@ -0,0 +1,31 @@
+package tcp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"testing"
+	"time"
+)
+
+type nopListener struct{}
+
+func (nopListener) Disconnect(string) error { return nil }
+
+func TestShutdownBeforeStart(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", &naming.DefaultService{Id: "chat01"})
+	srv.SetStateListener(nopListener{})
+	assert.Nil(t, srv.Shutdown(context.Background()))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Start()
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, wxf.ErrServerClosed, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("server is started after shutdown")
+	}
+}
@@ -0,0 +1,11 @@
+package tracing
+
+import "go.opentelemetry.io/otel/attribute"
+
+const (
+	CommandKey   = attribute.Key("wxf.command")
+	ChannelKey   = attribute.Key("wxf.channel_id")
+	ServiceKey   = attribute.Key("wxf.service")
+	ServiceIDKey = attribute.Key("wxf.service_id")
+	GatewayKey   = attribute.Key("wxf.gateway")
+)
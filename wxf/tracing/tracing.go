@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.14.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+)
+
+const TracerName = "github.com/wangxuefeng90923/wxf"
+
+const (
+	ExporterNone   = ""
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Init install a global tracer provider exporting spans of serviceName
+// to stdout or file, tracing stays disabled if exporter is ExporterNone.
+// the returned function flushes and stops the exporter
+func Init(serviceName, exporter, file string) (func(context.Context) error, error) {
+	var w io.Writer
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		w = os.Stdout
+	case ExporterFile:
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", exporter)
+	}
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if f, ok := w.(*os.File); ok && f != os.Stdout {
+			_ = f.Close()
+		}
+		return err
+	}, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Start starts a span whose parent is carried by header,
+// and then replace the trace meta of header with the new span
+func Start(header *pkt.Header, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(Extract(context.Background(), header), name, opts...)
+	span.SetAttributes(
+		CommandKey.String(header.Command),
+		ChannelKey.String(header.ChannelId),
+	)
+	Inject(ctx, header)
+	return ctx, span
+}
+
+// Extract returns a copy of ctx with the remote span carried by header,
+// the span is sampled only if it is propagated as sampled
+func Extract(ctx context.Context, header *pkt.Header) context.Context {
+	var (
+		traceID trace.TraceID
+		spanID  trace.SpanID
+		flags   trace.TraceFlags
+		err     error
+	)
+	for _, m := range header.Meta {
+		switch m.Key {
+		case wire.MetaTraceID:
+			traceID, err = trace.TraceIDFromHex(m.Value)
+		case wire.MetaSpanID:
+			spanID, err = trace.SpanIDFromHex(m.Value)
+		case wire.MetaTraceFlags:
+			var b []byte
+			if b, err = hex.DecodeString(m.Value); err == nil && len(b) == 1 {
+				flags = trace.TraceFlags(b[0])
+			}
+		}
+		if err != nil {
+			return ctx
+		}
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Inject writes the span of ctx to header, it does nothing
+// if ctx does not carry a valid span
+func Inject(ctx context.Context, header *pkt.Header) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header.SetStringMeta(wire.MetaTraceID, sc.TraceID().String())
+	header.SetStringMeta(wire.MetaSpanID, sc.SpanID().String())
+	header.SetStringMeta(wire.MetaTraceFlags, sc.TraceFlags().String())
+}
+
+// Strip deletes the span carried by header, so that internal trace IDs
+// are not exposed to clients, and spans of clients are not trusted
+func Strip(header *pkt.Header) {
+	header.DelMeta(wire.MetaTraceID)
+	header.DelMeta(wire.MetaSpanID)
+	header.DelMeta(wire.MetaTraceFlags)
+}
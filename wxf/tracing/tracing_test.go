@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/pkt"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("channel1"))
+	// gateway
+	_, span := Start(&packet.Header, "gateway.receive")
+	span.End()
+	traceID, ok := packet.GetMeta(wire.MetaTraceID)
+	assert.True(t, ok)
+	gatewaySpanID, _ := packet.GetMeta(wire.MetaSpanID)
+
+	// transfer through the wire
+	logicPkt, err := pkt.MustReadLogicPkt(bytesOf(packet))
+	assert.Nil(t, err)
+
+	// logic service
+	_, span = Start(&logicPkt.Header, "router.serve")
+	span.End()
+	id, _ := logicPkt.GetMeta(wire.MetaTraceID)
+	assert.Equal(t, traceID, id)
+	spanID, _ := logicPkt.GetMeta(wire.MetaSpanID)
+	assert.NotEqual(t, gatewaySpanID, spanID)
+	// meta is replaced rather than appended
+	assert.Equal(t, 3, len(logicPkt.Meta))
+
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.True(t, spans[1].Parent().IsRemote())
+
+	Strip(&logicPkt.Header)
+	assert.Equal(t, 0, len(logicPkt.Meta))
+}
+
+func TestExtractSampled(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.NeverSample())),
+		sdktrace.WithSpanProcessor(recorder),
+	))
+	header := &pkt.Header{Meta: []*pkt.Meta{
+		{Key: wire.MetaTraceID, Value: "0102030405060708090a0b0c0d0e0f10"},
+		{Key: wire.MetaSpanID, Value: "0102030405060708"},
+	}}
+	// spans without sampled flag are not forced to be sampled
+	_, span := Start(header, "router.serve")
+	span.End()
+	assert.False(t, span.SpanContext().IsSampled())
+	flags, _ := header.GetStringMeta(wire.MetaTraceFlags)
+	assert.Equal(t, "00", flags)
+
+	header.SetStringMeta(wire.MetaTraceFlags, "01")
+	_, span = Start(header, "router.serve")
+	span.End()
+	assert.True(t, span.SpanContext().IsSampled())
+	assert.Equal(t, 1, len(recorder.Ended()))
+
+	// the root span is left to the sampler
+	Strip(header)
+	assert.Equal(t, 0, len(header.Meta))
+	_, span = Start(header, "gateway.receive")
+	span.End()
+	assert.False(t, span.SpanContext().IsSampled())
+}
+
+func TestExtractInvalid(t *testing.T) {
+	header := &pkt.Header{Meta: []*pkt.Meta{
+		{Key: wire.MetaTraceID, Value: "not a trace id"},
+	}}
+	ctx := Extract(context.Background(), header)
+	assert.Equal(t, context.Background(), ctx)
+}
+
+func TestInit(t *testing.T) {
+	shutdown, err := Init("test", ExporterNone, "")
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+
+	_, err = Init("test", "unknown", "")
+	assert.NotNil(t, err)
+}
+
+func bytesOf(p *pkt.LogicPkt) *bytes.Buffer {
+	return bytes.NewBuffer(pkt.Marshal(p))
+}
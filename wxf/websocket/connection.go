@@ -53,6 +53,11 @@ func (wc *WsConn) WriteFrame(code wxf.OpCode, payload []byte) error {
 	return ws.WriteFrame(wc.Conn, f)
 }
 
+// PrepareFrame implements wxf.FramePreparer
+func (wc *WsConn) PrepareFrame(code wxf.OpCode, payload []byte) ([]byte, error) {
+	return ws.CompileFrame(ws.NewFrame(ws.OpCode(code), true, payload))
+}
+
 func (wc *WsConn) Flush() error {
 	//TODO implement me
 	panic("implement me")
@@ -8,6 +8,8 @@ import (
 	"github.com/segmentio/ksuid"
 	"github.com/sirupsen/logrus"
 	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/metrics"
+	"net"
 	"net/http"
 	"sync"
 	"sync/atomic"
@@ -30,6 +32,8 @@ type Server struct {
 	sync.Once
 	options ServerOptions
 	quit    int32
+	lock    sync.Mutex
+	httpSrv *http.Server
 }
 
 func NewServer(listen string, service wxf.ServiceRegistration) wxf.Server {
@@ -72,10 +76,12 @@ func (s *Server) Start() error {
 		conn := NewConn(rawConn)
 		id, err := s.Accept(conn, s.options.loginWait)
 		if err != nil {
+			metrics.HandshakeTotal.WithLabelValues(s.ServiceID(), s.ServiceName(), metrics.HandshakeRejected).Inc()
 			_ = conn.WriteFrame(wxf.OpClose, []byte(err.Error()))
 			conn.Close()
 			return
 		}
+		metrics.HandshakeTotal.WithLabelValues(s.ServiceID(), s.ServiceName(), metrics.HandshakeAccepted).Inc()
 		if _, ok := s.Get(id); ok {
 			log.Warnf("channel %s existed", id)
 			_ = conn.WriteFrame(wxf.OpClose, []byte("channelId is repeated"))
@@ -85,7 +91,13 @@ func (s *Server) Start() error {
 		channel := wxf.NewChannel(id, conn)
 		channel.SetWriteWait(s.options.writeWait)
 		channel.SetReadWait(s.options.readWait)
+		if negotiator, ok := s.Acceptor.(wxf.FrameNegotiator); ok {
+			channel.SetFrameEncoder(negotiator.FrameEncoder(id))
+			channel.SetMaxFrameSize(negotiator.MaxFrameSize(id))
+		}
 		s.Add(channel)
+		gauge := metrics.ChannelTotalGauge.WithLabelValues(s.ServiceID(), s.ServiceName())
+		gauge.Inc()
 
 		go func(ch wxf.Channel) {
 			err := ch.Readloop(s.MessageListener)
@@ -93,6 +105,7 @@ func (s *Server) Start() error {
 				log.Info(err)
 			}
 			s.Remove(ch.ID())
+			gauge.Dec()
 			err = s.Disconnect(ch.ID())
 			if err != nil {
 				log.Warn(err)
@@ -100,8 +113,36 @@ func (s *Server) Start() error {
 			ch.Close()
 		}(channel)
 	})
+	if atomic.LoadInt32(&s.quit) == 1 {
+		return wxf.ErrServerClosed
+	}
 	log.Infoln("started")
-	return http.ListenAndServe(s.listen, mux)
+	lst, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return err
+	}
+	httpSrv := &http.Server{Handler: mux}
+	// Shutdown may run while listening, it sets quit before the lock
+	s.lock.Lock()
+	if atomic.LoadInt32(&s.quit) == 1 {
+		s.lock.Unlock()
+		_ = lst.Close()
+		return wxf.ErrServerClosed
+	}
+	s.httpSrv = httpSrv
+	s.lock.Unlock()
+	err = httpSrv.Serve(lst)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Listening reports whether the server is accepting connections
+func (s *Server) Listening() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.httpSrv != nil && atomic.LoadInt32(&s.quit) == 0
 }
 
 func (s *Server) SetAcceptor(acceptor wxf.Acceptor) {
@@ -132,6 +173,14 @@ func (s *Server) Push(id string, data []byte) error {
 	return ch.Push(data)
 }
 
+func (s *Server) PushFrame(id string, frame *wxf.PreparedFrame) error {
+	ch, ok := s.ChannelMap.Get(id)
+	if !ok {
+		return errors.New("channel no found")
+	}
+	return ch.PushFrame(frame)
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	log := logrus.WithFields(logrus.Fields{
 		"module": s.ServiceName(),
@@ -141,7 +190,15 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		defer func() {
 			log.Infoln("shutdown")
 		}()
-		if atomic.CompareAndSwapInt32(&s.quit, 0, 1) {
+		if !atomic.CompareAndSwapInt32(&s.quit, 0, 1) {
+			return
+		}
+		s.lock.Lock()
+		if s.httpSrv != nil {
+			_ = s.httpSrv.Shutdown(ctx)
+		}
+		s.lock.Unlock()
+		if s.ChannelMap == nil {
 			return
 		}
 		channels := s.ChannelMap.All()
@@ -0,0 +1,276 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf"
+	"github.com/wangxuefeng90923/wxf/naming"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// discardConn keeps the frames written to it in buf if keep is set
+type discardConn struct {
+	net.Conn
+	sync.Mutex
+	keep bool
+	buf  bytes.Buffer
+}
+
+func (c *discardConn) Write(p []byte) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.keep {
+		c.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (c *discardConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *discardConn) Close() error {
+	return nil
+}
+
+func newFanOutServer(n int) (*Server, []string) {
+	srv := NewServer(":0", &naming.DefaultService{Id: "gateway01"}).(*Server)
+	channels := wxf.NewChannels(n)
+	ids := make([]string, n)
+	for i := 0; i < n; i++ {
+		ids[i] = fmt.Sprintf("gateway01_test%d", i)
+		channels.Add(wxf.NewChannel(ids[i], NewConn(&discardConn{})))
+	}
+	srv.SetChannelMap(channels)
+	return srv, ids
+}
+
+func TestPushFrame(t *testing.T) {
+	conn := &discardConn{keep: true}
+	ch := wxf.NewChannel("ch1", NewConn(conn))
+	defer ch.Close()
+	payload := []byte("hello")
+	assert.Nil(t, ch.PushFrame(wxf.NewPreparedFrame(wxf.OpBinary, payload)))
+	assert.Nil(t, ch.Push(payload))
+
+	assert.Eventually(t, func() bool {
+		conn.Lock()
+		defer conn.Unlock()
+		return conn.buf.Len() > 0
+	}, time.Second, time.Millisecond*10)
+	conn.Lock()
+	defer conn.Unlock()
+	for i := 0; i < 2; i++ {
+		frame, err := ws.ReadFrame(&conn.buf)
+		assert.Nil(t, err)
+		assert.Equal(t, ws.OpBinary, frame.Header.OpCode)
+		assert.Equal(t, payload, frame.Payload)
+	}
+}
+
+func TestPushFrameRelease(t *testing.T) {
+	released := make(chan struct{})
+	frame := wxf.NewPreparedFrame(wxf.OpBinary, []byte("hello"))
+	frame.SetRelease(3, func() { close(released) })
+	for _, id := range []string{"ch1", "ch2"} {
+		ch := wxf.NewChannel(id, NewConn(&discardConn{}))
+		defer ch.Close()
+		assert.Nil(t, ch.PushFrame(frame))
+	}
+	select {
+	case <-released:
+		t.Fatal("frame is released before all users released it")
+	case <-time.After(time.Millisecond * 100):
+	}
+	frame.Release()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("frame is not released")
+	}
+}
+
+// blockConn blocks writes until it is closed
+type blockConn struct {
+	discardConn
+	closed chan struct{}
+}
+
+func (c *blockConn) Write(p []byte) (int, error) {
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *blockConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestCloseReleaseQueued(t *testing.T) {
+	var released int32
+	ch := wxf.NewChannel("ch1", NewConn(&blockConn{closed: make(chan struct{})}))
+	// the first frame is being written, the others are queued
+	for i := 0; i < 4; i++ {
+		frame := wxf.NewPreparedFrame(wxf.OpBinary, []byte("hello"))
+		frame.SetRelease(1, func() { atomic.AddInt32(&released, 1) })
+		assert.Nil(t, ch.PushFrame(frame))
+	}
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&released))
+
+	assert.Nil(t, ch.Close())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&released) == 4
+	}, time.Second, time.Millisecond*10)
+
+	frame := wxf.NewPreparedFrame(wxf.OpBinary, []byte("hello"))
+	assert.Equal(t, wxf.ErrChannelClosed, ch.PushFrame(frame))
+}
+
+// countEncoder counts payloads it encoded
+type countEncoder struct {
+	count int32
+}
+
+func (e *countEncoder) EncodeFrame(payload []byte) (wxf.OpCode, []byte, error) {
+	atomic.AddInt32(&e.count, 1)
+	return wxf.OpText, payload, nil
+}
+
+func TestPushFrameEncoded(t *testing.T) {
+	encoder := &countEncoder{}
+	frame := wxf.NewPreparedFrame(wxf.OpBinary, []byte("hello"))
+	released := make(chan struct{})
+	frame.SetRelease(10, func() { close(released) })
+	for i := 0; i < 10; i++ {
+		ch := wxf.NewChannel(fmt.Sprintf("ch%d", i), NewConn(&discardConn{}))
+		ch.SetFrameEncoder(encoder)
+		defer ch.Close()
+		assert.Nil(t, ch.PushFrame(frame))
+	}
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("frame is not written")
+	}
+	// the frame is encoded once for all channels sharing the encoder
+	assert.Equal(t, int32(1), atomic.LoadInt32(&encoder.count))
+}
+
+// baselineChannel writes payloads pushed in the way channels did before
+// frames were prepared, each of them is encoded by conn.WriteFrame
+type baselineChannel struct {
+	wxf.Channel
+	id        string
+	conn      wxf.Conn
+	writeChan chan []byte
+}
+
+func newBaselineChannel(id string, conn wxf.Conn) *baselineChannel {
+	ch := &baselineChannel{id: id, conn: conn, writeChan: make(chan []byte, 5)}
+	go func() {
+		for payload := range ch.writeChan {
+			_ = ch.conn.SetWriteDeadline(time.Now().Add(time.Second * 10))
+			_ = ch.conn.WriteFrame(wxf.OpBinary, payload)
+		}
+	}()
+	return ch
+}
+
+func (c *baselineChannel) ID() string { return c.id }
+
+func (c *baselineChannel) Push(payload []byte) error {
+	c.writeChan <- payload
+	return nil
+}
+
+// BenchmarkFanOutPush pushes a group message to 1000 channels
+// which encode frames on their own, as the baseline push path did
+func BenchmarkFanOutPush(b *testing.B) {
+	srv := NewServer(":0", &naming.DefaultService{Id: "gateway01"}).(*Server)
+	channels := wxf.NewChannels(1000)
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("gateway01_test%d", i)
+		ch := newBaselineChannel(ids[i], NewConn(&discardConn{}))
+		defer close(ch.writeChan)
+		channels.Add(ch)
+	}
+	srv.SetChannelMap(channels)
+	payload := bytes.Repeat([]byte("hello"), 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, id := range ids {
+			_ = srv.Push(id, payload)
+		}
+	}
+}
+
+// BenchmarkFanOutPushFrame pushes a group message to 1000 channels
+// sharing a prepared frame
+func BenchmarkFanOutPushFrame(b *testing.B) {
+	srv, ids := newFanOutServer(1000)
+	payload := bytes.Repeat([]byte("hello"), 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame := wxf.NewPreparedFrame(wxf.OpBinary, payload)
+		for _, id := range ids {
+			_ = srv.PushFrame(id, frame)
+		}
+	}
+}
+
+type nopListener struct{}
+
+func (nopListener) Disconnect(string) error { return nil }
+
+func TestShutdownBeforeStart(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", &naming.DefaultService{Id: "gateway01"})
+	srv.SetStateListener(nopListener{})
+	assert.Nil(t, srv.Shutdown(context.Background()))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Start()
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, wxf.ErrServerClosed, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("server is started after shutdown")
+	}
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	ch := wxf.NewChannel("ch1", NewConn(srv))
+	ch.SetMaxFrameSize(8)
+	defer ch.Close()
+
+	go func() {
+		_ = wsutil.WriteClientBinary(cli, []byte("hello"))
+		_ = wsutil.WriteClientBinary(cli, []byte("hello world"))
+	}()
+	received := make(chan []byte, 2)
+	err := ch.Readloop(receiveFunc(func(_ wxf.Agent, payload []byte) {
+		received <- payload
+	}))
+	assert.Equal(t, wxf.ErrFrameTooLarge, err)
+	assert.Equal(t, []byte("hello"), <-received)
+	assert.Equal(t, 0, len(received))
+}
+
+type receiveFunc func(wxf.Agent, []byte)
+
+func (f receiveFunc) Receive(agent wxf.Agent, payload []byte) { f(agent, payload) }
@@ -13,11 +13,16 @@ var (
 
 const (
 	AlgorithmHashSlots = "hashslots"
+	AlgorithmWeighted  = "weighted"
+	AlgorithmLeastLoad = "leastload"
+	AlgorithmZoneAware = "zone"
 )
 
 const (
 	CommandLoginSignIn  = "login.signin"
 	CommandLoginSignOut = "login.signout"
+	CommandLoginKickout = "login.kickout"
+	CommandLoginRefresh = "login.refresh"
 
 	CommandChatUserTalk  = "chat.user.talk"
 	CommandChatGroupTalk = "chat.group.talk"
@@ -37,13 +42,46 @@ const (
 const (
 	MetaDestServer   = "dest.server"
 	MetaDestChannels = "dest.channels"
+	MetaTraceID      = "trace.id"
+	MetaSpanID       = "trace.span"
+	MetaTraceFlags   = "trace.flags"
+	MetaContentType  = "content.type"
+	MetaCompression  = "compression"
+	MetaTimestamp    = "ts"
+	MetaSignature    = "sign"
+	// MetaGateway is the id of gateway originating a packet, it is
+	// stripped from packets of clients
+	MetaGateway = "gateway"
 )
 
+// GatewayCommands are originated by gateway only, the same commands
+// sent by clients are rejected
+var GatewayCommands = map[string]bool{
+	CommandLoginSignIn:  true,
+	CommandLoginSignOut: true,
+	CommandLoginKickout: true,
+}
+
 const (
 	ProtocolTCP       Protocol = "tcp"
 	ProtocolWebsocket Protocol = "websocket"
 )
 
+// Compression algorithm of packet body
+const (
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// Protocol version negotiated in login, SDKs without a version
+// in LoginReq are taken as ProtocolVersionLegacy
+const (
+	ProtocolVersionLegacy uint32 = 1
+	// ProtocolVersion2 negotiates capabilities in login
+	ProtocolVersion2 uint32 = 2
+	ProtocolVersion         = ProtocolVersion2
+)
+
 // Service Name
 const (
 	SNWGateway = "wgateway"
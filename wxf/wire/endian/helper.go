@@ -2,13 +2,23 @@ package endian
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
 var Default = binary.BigEndian
 
+// allocChunk is the max size of buffer allocated before its data is read
+const allocChunk = 64 * 1024
+
+var ErrNegativeLength = errors.New("length is negative")
+
 // ReadUint8 from reader read one uint8
 func ReadUint8(r io.Reader) (uint8, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		v, err := readUint(br, 1)
+		return uint8(v), err
+	}
 	var bytes = make([]byte, 1)
 	if _, err := io.ReadFull(r, bytes); err != nil {
 		return 0, err
@@ -17,6 +27,10 @@ func ReadUint8(r io.Reader) (uint8, error) {
 }
 
 func ReadUint32(r io.Reader) (uint32, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		v, err := readUint(br, 4)
+		return uint32(v), err
+	}
 	var bytes = make([]byte, 4)
 	if _, err := io.ReadFull(r, bytes); err != nil {
 		return 0, err
@@ -26,6 +40,10 @@ func ReadUint32(r io.Reader) (uint32, error) {
 
 // ReadUint16 从 reader 中读取一个 uint16
 func ReadUint16(r io.Reader) (uint16, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		v, err := readUint(br, 2)
+		return uint16(v), err
+	}
 	var bytes = make([]byte, 2)
 	if _, err := io.ReadFull(r, bytes); err != nil {
 		return 0, err
@@ -35,6 +53,9 @@ func ReadUint16(r io.Reader) (uint16, error) {
 
 // ReadUint64 从 reader 中读取一个 uint64
 func ReadUint64(r io.Reader) (uint64, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return readUint(br, 8)
+	}
 	var bytes = make([]byte, 8)
 	if _, err := io.ReadFull(r, bytes); err != nil {
 		return 0, err
@@ -42,6 +63,33 @@ func ReadUint64(r io.Reader) (uint64, error) {
 	return Default.Uint64(bytes), nil
 }
 
+// readUint reads a big endian integer of size bytes without allocation,
+// errors are the same as io.ReadFull
+func readUint(br io.ByteReader, size int) (uint64, error) {
+	var v uint64
+	for i := 0; i < size; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// writeUint writes a big endian integer of size bytes without allocation
+func writeUint(bw io.ByteWriter, v uint64, size int) error {
+	for i := size - 1; i >= 0; i-- {
+		if err := bw.WriteByte(byte(v >> (8 * i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ReadString 从 reader 中读取一个 string
 func ReadString(r io.Reader) (string, error) {
 	buf, err := ReadBytes(r)
@@ -57,26 +105,49 @@ func ReadBytes(r io.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	buf := make([]byte, bufLen)
-	_, err = io.ReadFull(r, buf)
-	if err != nil {
-		return nil, err
-	}
-	return buf, nil
+	return readN(r, int64(bufLen))
 }
 
 // ReadFixedBytes 读取固定长度的字节
 func ReadFixedBytes(len int, r io.Reader) ([]byte, error) {
-	buf := make([]byte, len)
-	_, err := io.ReadFull(r, buf)
-	if err != nil {
-		return nil, err
+	if len < 0 {
+		return nil, ErrNegativeLength
+	}
+	return readN(r, int64(len))
+}
+
+// readN reads n bytes, the buffer grows by chunks as data arrives so
+// that a huge length from untrusted input does not allocate up front
+func readN(r io.Reader, n int64) ([]byte, error) {
+	size := n
+	if size > allocChunk {
+		size = allocChunk
+	}
+	buf := make([]byte, size)
+	for {
+		read := int64(len(buf)) - size
+		if _, err := io.ReadFull(r, buf[read:]); err != nil {
+			if err == io.EOF && read > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if int64(len(buf)) == n {
+			return buf, nil
+		}
+		size = n - int64(len(buf))
+		if size > allocChunk {
+			size = allocChunk
+		}
+		buf = append(buf, make([]byte, size)...)
 	}
-	return buf, nil
 }
 
 // WriteUint8 写一个 uint8到 writer 中
 func WriteUint8(w io.Writer, val uint8) error {
+	if bw, ok := w.(io.ByteWriter); ok {
+		return writeUint(bw, uint64(val), 1)
+	}
 	buf := []byte{byte(val)}
 	if _, err := w.Write(buf); err != nil {
 		return err
@@ -86,6 +157,9 @@ func WriteUint8(w io.Writer, val uint8) error {
 
 // WriteUint16 写一个 int16到 writer 中
 func WriteUint16(w io.Writer, val uint16) error {
+	if bw, ok := w.(io.ByteWriter); ok {
+		return writeUint(bw, uint64(val), 2)
+	}
 	buf := make([]byte, 2)
 	Default.PutUint16(buf, val)
 	if _, err := w.Write(buf); err != nil {
@@ -96,6 +170,9 @@ func WriteUint16(w io.Writer, val uint16) error {
 
 // WriteUint32 写一个 int32到 writer 中
 func WriteUint32(w io.Writer, val uint32) error {
+	if bw, ok := w.(io.ByteWriter); ok {
+		return writeUint(bw, uint64(val), 4)
+	}
 	buf := make([]byte, 4)
 	Default.PutUint32(buf, val)
 	if _, err := w.Write(buf); err != nil {
@@ -106,6 +183,9 @@ func WriteUint32(w io.Writer, val uint32) error {
 
 // WriteUint64 写一个 int64到 writer 中
 func WriteUint64(w io.Writer, val uint64) error {
+	if bw, ok := w.(io.ByteWriter); ok {
+		return writeUint(bw, val, 8)
+	}
 	buf := make([]byte, 8)
 	Default.PutUint64(buf, val)
 	if _, err := w.Write(buf); err != nil {
@@ -152,12 +232,7 @@ func ReadShortBytes(r io.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	buf := make([]byte, bufLen)
-	_, err = io.ReadFull(r, buf)
-	if err != nil {
-		return nil, err
-	}
-	return buf, nil
+	return readN(r, int64(bufLen))
 }
 
 func ReadShortString(r io.Reader) (string, error) {
@@ -0,0 +1,70 @@
+package endian
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestReadBytes(t *testing.T) {
+	buf := new(bytes.Buffer)
+	data := bytes.Repeat([]byte("a"), allocChunk*2+10)
+	assert.Nil(t, WriteBytes(buf, data))
+	assert.Nil(t, WriteString(buf, "hello"))
+	assert.Nil(t, WriteShortBytes(buf, []byte("short")))
+
+	got, err := ReadBytes(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, data, got)
+	s, err := ReadString(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", s)
+	s, err = ReadShortString(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "short", s)
+	_, err = ReadBytes(buf)
+	assert.Equal(t, io.EOF, err)
+
+	// a huge length prefix fails without allocating its size
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3}
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err = ReadBytes(bytes.NewReader(huge))
+	})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Less(t, allocs, float64(3))
+
+	_, err = ReadFixedBytes(-1, bytes.NewReader(huge))
+	assert.Equal(t, ErrNegativeLength, err)
+}
+
+func FuzzReadBytes(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{0, 0, 0, 3, 'a', 'b', 'c'})
+	f.Add([]byte{0, 0, 0, 5, 'a'})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 'a'})
+	f.Add([]byte{0, 2, 'a', 'b'})
+	f.Add([]byte{0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if buf, err := ReadBytes(bytes.NewReader(data)); err == nil {
+			if len(buf) != int(Default.Uint32(data)) {
+				t.Fatalf("read %d bytes, length prefix is %d", len(buf), Default.Uint32(data))
+			}
+			out := new(bytes.Buffer)
+			_ = WriteBytes(out, buf)
+			if !bytes.Equal(out.Bytes(), data[:out.Len()]) {
+				t.Fatalf("bytes are changed in round trip")
+			}
+		}
+		if buf, err := ReadShortBytes(bytes.NewReader(data)); err == nil {
+			if len(buf) != int(Default.Uint16(data)) {
+				t.Fatalf("read %d bytes, length prefix is %d", len(buf), Default.Uint16(data))
+			}
+		}
+		r := bytes.NewReader(data)
+		_, _ = ReadUint8(r)
+		_, _ = ReadUint16(r)
+		_, _ = ReadUint32(r)
+		_, _ = ReadUint64(r)
+	})
+}
@@ -1,6 +1,7 @@
 package pkt
 
 import (
+	"errors"
 	"github.com/wangxuefeng90923/wxf/wire/endian"
 	"io"
 )
@@ -8,8 +9,13 @@ import (
 const (
 	CodePing = uint16(1)
 	CodePong = uint16(2)
+	// CodeAck acknowledges a logic packet received by gateway, it is
+	// sent to SDKs which negotiated ack, the body is the sequence
+	CodeAck = uint16(3)
 )
 
+var ErrInvalidAck = errors.New("packet is not a valid ack")
+
 type BasicPkt struct {
 	Code   uint16
 	Length uint16
@@ -46,3 +52,18 @@ func (p *BasicPkt) Encode(w io.Writer) error {
 	}
 	return nil
 }
+
+// NewAck returns an ack of the logic packet of seq
+func NewAck(seq uint32) *BasicPkt {
+	body := make([]byte, 4)
+	endian.Default.PutUint32(body, seq)
+	return &BasicPkt{Code: CodeAck, Length: 4, Body: body}
+}
+
+// AckSequence returns the sequence acknowledged by an ack
+func (p *BasicPkt) AckSequence() (uint32, error) {
+	if p.Code != CodeAck || len(p.Body) != 4 {
+		return 0, ErrInvalidAck
+	}
+	return endian.Default.Uint32(p.Body), nil
+}
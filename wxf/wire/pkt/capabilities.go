@@ -0,0 +1,63 @@
+package pkt
+
+import "github.com/wangxuefeng90923/wxf/wire"
+
+// LegacyCapabilities are the capabilities of SDKs without versioning
+func LegacyCapabilities() *Capabilities {
+	return &Capabilities{
+		ContentTypes: []ContentType{ContentType_Protobuf},
+	}
+}
+
+// Negotiate returns the protocol version and the capabilities supported
+// by both of SDK and server, compressions are kept in the order of SDK
+func Negotiate(version uint32, client, server *Capabilities) (uint32, *Capabilities) {
+	if version == 0 || client == nil {
+		return wire.ProtocolVersionLegacy, LegacyCapabilities()
+	}
+	if version > wire.ProtocolVersion {
+		version = wire.ProtocolVersion
+	}
+	caps := &Capabilities{
+		Ack:       client.Ack && server.Ack,
+		Integrity: client.Integrity && server.Integrity,
+	}
+	for _, c := range client.Compressions {
+		if contains(server.Compressions, c) {
+			caps.Compressions = append(caps.Compressions, c)
+		}
+	}
+	for _, ct := range client.ContentTypes {
+		for _, sct := range server.ContentTypes {
+			if ct == sct {
+				caps.ContentTypes = append(caps.ContentTypes, ct)
+				break
+			}
+		}
+	}
+	if len(caps.ContentTypes) == 0 {
+		caps.ContentTypes = []ContentType{ContentType_Protobuf}
+	}
+	caps.MaxFrameSize = client.MaxFrameSize
+	if caps.MaxFrameSize == 0 || server.MaxFrameSize != 0 && server.MaxFrameSize < caps.MaxFrameSize {
+		caps.MaxFrameSize = server.MaxFrameSize
+	}
+	return version, caps
+}
+
+// Compression returns the preferred compression, or "" if none
+func (x *Capabilities) Compression() string {
+	if len(x.GetCompressions()) == 0 {
+		return ""
+	}
+	return x.Compressions[0]
+}
+
+func contains(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
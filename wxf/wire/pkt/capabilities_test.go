@@ -0,0 +1,38 @@
+package pkt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	server := &Capabilities{
+		Compressions: []string{"snappy", "zstd"},
+		ContentTypes: []ContentType{ContentType_Protobuf, ContentType_Json},
+		MaxFrameSize: 1 << 20,
+		Ack:          true,
+	}
+	// SDKs without versioning
+	version, caps := Negotiate(0, nil, server)
+	assert.Equal(t, wire.ProtocolVersionLegacy, version)
+	assert.Equal(t, []ContentType{ContentType_Protobuf}, caps.ContentTypes)
+	assert.Empty(t, caps.Compressions)
+	assert.False(t, caps.Ack)
+
+	version, caps = Negotiate(wire.ProtocolVersion+1, &Capabilities{
+		Compressions: []string{"zstd", "gzip", "snappy"},
+		ContentTypes: []ContentType{ContentType_Json},
+		Ack:          true,
+	}, server)
+	assert.Equal(t, wire.ProtocolVersion, version)
+	assert.Equal(t, []string{"zstd", "snappy"}, caps.Compressions)
+	assert.Equal(t, []ContentType{ContentType_Json}, caps.ContentTypes)
+	assert.Equal(t, uint32(1<<20), caps.MaxFrameSize)
+	assert.True(t, caps.Ack)
+
+	_, caps = Negotiate(wire.ProtocolVersion, &Capabilities{MaxFrameSize: 1024}, server)
+	assert.Equal(t, uint32(1024), caps.MaxFrameSize)
+	assert.Equal(t, []ContentType{ContentType_Protobuf}, caps.ContentTypes)
+	assert.False(t, caps.Ack)
+}
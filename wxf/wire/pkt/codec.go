@@ -0,0 +1,178 @@
+package pkt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/endian"
+	protov2 "google.golang.org/protobuf/proto"
+	"sync"
+)
+
+// maxPooledBuffer is the largest capacity of buffers put back to pool,
+// so that a few huge packets do not pin memory
+const maxPooledBuffer = 64 * 1024
+
+var ErrShortPacket = errors.New("packet is too short")
+
+// Buffer holds an encoded packet from Encode, call Free after the
+// bytes are not used any more
+type Buffer struct {
+	b []byte
+}
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return &Buffer{b: make([]byte, 0, 512)}
+	},
+}
+
+func (b *Buffer) Bytes() []byte {
+	return b.b
+}
+
+// Free puts the buffer back to pool, its bytes must not be used after
+func (b *Buffer) Free() {
+	if cap(b.b) > maxPooledBuffer {
+		return
+	}
+	b.b = b.b[:0]
+	bufferPool.Put(b)
+}
+
+// Encode encodes p with its magic code into a pooled buffer, the
+// result is the same as Marshal but without reflection and allocation
+func Encode(p Packet) (*Buffer, error) {
+	buf := bufferPool.Get().(*Buffer)
+	var err error
+	buf.b, err = AppendPacket(buf.b[:0], p)
+	if err != nil {
+		buf.Free()
+		return nil, err
+	}
+	return buf, nil
+}
+
+// AppendPacket appends p with its magic code to dst
+func AppendPacket(dst []byte, p Packet) ([]byte, error) {
+	switch p := p.(type) {
+	case *LogicPkt:
+		dst = append(dst, wire.MagicLogicPkt[:]...)
+		return p.appendTo(dst)
+	case *BasicPkt:
+		dst = append(dst, wire.MagicBasicPkt[:]...)
+		return p.appendTo(dst), nil
+	default:
+		return dst, fmt.Errorf("unknown packet %T", p)
+	}
+}
+
+func (p *LogicPkt) appendTo(dst []byte) ([]byte, error) {
+	// the length of header is filled after it is marshaled
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	dst, err := protov2.MarshalOptions{}.MarshalAppend(dst, &p.Header)
+	if err != nil {
+		return dst, err
+	}
+	endian.Default.PutUint32(dst[start:], uint32(len(dst)-start-4))
+	dst = endian.Default.AppendUint32(dst, uint32(len(p.Body)))
+	return append(dst, p.Body...), nil
+}
+
+func (p *BasicPkt) appendTo(dst []byte) []byte {
+	dst = endian.Default.AppendUint16(dst, p.Code)
+	dst = endian.Default.AppendUint16(dst, p.Length)
+	if p.Length > 0 {
+		dst = append(dst, p.Body...)
+	}
+	return dst
+}
+
+// Unmarshal decodes a packet with its magic code like Read, the body
+// of packet refers to data instead of a copy
+func Unmarshal(data []byte) (interface{}, error) {
+	if len(data) < len(wire.Magic{}) {
+		return nil, ErrShortPacket
+	}
+	var magic wire.Magic
+	copy(magic[:], data)
+	switch magic {
+	case wire.MagicBasicPkt:
+		p := new(BasicPkt)
+		if err := UnmarshalBasicPkt(data[4:], p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case wire.MagicLogicPkt:
+		p := new(LogicPkt)
+		if err := UnmarshalLogicPkt(data[4:], p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("magic code %s is incorrect", magic)
+	}
+}
+
+// MustUnmarshalLogicPkt decodes a logic packet with its magic code into p
+// like MustReadLogicPkt, p can be reused and its body refers to data
+func MustUnmarshalLogicPkt(data []byte, p *LogicPkt) error {
+	if len(data) < len(wire.Magic{}) {
+		return ErrShortPacket
+	}
+	var magic wire.Magic
+	copy(magic[:], data)
+	if magic != wire.MagicLogicPkt {
+		return fmt.Errorf("packet is not a logic packet")
+	}
+	return UnmarshalLogicPkt(data[4:], p)
+}
+
+// UnmarshalLogicPkt decodes data without magic code into p, p can be
+// reused as all of its fields are reset, and its body refers to data
+func UnmarshalLogicPkt(data []byte, p *LogicPkt) error {
+	p.Header.Reset()
+	p.Body = nil
+	p.compression = ""
+	p.text = false
+	header, data, err := readBytes(data)
+	if err != nil {
+		return err
+	}
+	if err = protov2.Unmarshal(header, &p.Header); err != nil {
+		return err
+	}
+	p.Body, _, err = readBytes(data)
+	return err
+}
+
+// UnmarshalBasicPkt decodes data without magic code into p
+func UnmarshalBasicPkt(data []byte, p *BasicPkt) error {
+	if len(data) < 4 {
+		return ErrShortPacket
+	}
+	p.Code = endian.Default.Uint16(data)
+	p.Length = endian.Default.Uint16(data[2:])
+	p.Body = nil
+	if p.Length > 0 {
+		if len(data)-4 < int(p.Length) {
+			return ErrShortPacket
+		}
+		p.Body = data[4 : 4+int(p.Length)]
+	}
+	return nil
+}
+
+// readBytes reads a []byte prefixed by its uint32 length
+func readBytes(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, ErrShortPacket
+	}
+	n := endian.Default.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) < uint64(n) {
+		return nil, nil, ErrShortPacket
+	}
+	return data[:n], data[n:], nil
+}
@@ -0,0 +1,103 @@
+package pkt
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"testing"
+)
+
+func newTestPkt() *LogicPkt {
+	p := New(wire.CommandChatGroupTalk, WithChannel("gateway01_test1"), WithDest("group1"), WithSeq(10))
+	p.AddStringMeta(wire.MetaDestServer, "gateway01")
+	p.Body = bytes.Repeat([]byte("hello"), 40)
+	return p
+}
+
+func TestEncode(t *testing.T) {
+	p := newTestPkt()
+	buf, err := Encode(p)
+	assert.Nil(t, err)
+	assert.Equal(t, Marshal(p), buf.Bytes())
+
+	val, err := Unmarshal(buf.Bytes())
+	assert.Nil(t, err)
+	p2 := val.(*LogicPkt)
+	assert.Equal(t, p.Command, p2.Command)
+	assert.Equal(t, p.Sequence, p2.Sequence)
+	assert.Equal(t, "gateway01", p2.Meta[0].Value)
+	assert.Equal(t, p.Body, p2.Body)
+	buf.Free()
+
+	basic := &BasicPkt{Code: CodePing, Length: 2, Body: []byte{1, 2}}
+	buf, err = Encode(basic)
+	assert.Nil(t, err)
+	assert.Equal(t, Marshal(basic), buf.Bytes())
+	val, err = Unmarshal(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, basic, val)
+	buf.Free()
+}
+
+func TestUnmarshalShort(t *testing.T) {
+	data := Marshal(newTestPkt())
+	for i := 0; i < len(data); i++ {
+		_, err := Unmarshal(data[:i])
+		assert.NotNil(t, err, i)
+	}
+	_, err := Unmarshal(Marshal(&BasicPkt{Code: CodePing, Length: 2, Body: []byte{1, 2}})[:7])
+	assert.Equal(t, ErrShortPacket, err)
+}
+
+func TestUnmarshalReuse(t *testing.T) {
+	p := newTestPkt()
+	p.SetCompression(wire.CompressionSnappy)
+	src := New(wire.CommandLoginSignIn)
+	data := Marshal(src)
+
+	assert.Nil(t, MustUnmarshalLogicPkt(data, p))
+	assert.Equal(t, wire.CommandLoginSignIn, p.Command)
+	assert.Equal(t, src.Sequence, p.Sequence)
+	assert.Equal(t, "", p.ChannelId)
+	assert.Equal(t, "", p.Dest)
+	assert.Equal(t, 0, len(p.Meta))
+	assert.Equal(t, 0, len(p.Body))
+	assert.Equal(t, "", p.compression)
+
+	assert.NotNil(t, MustUnmarshalLogicPkt(Marshal(&BasicPkt{Code: CodePing}), p))
+	assert.Equal(t, ErrShortPacket, MustUnmarshalLogicPkt(data[:2], p))
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	p := newTestPkt()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Marshal(p)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	p := newTestPkt()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ := Encode(p)
+		buf.Free()
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	data := Marshal(newTestPkt())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = Read(bytes.NewBuffer(data))
+	}
+}
+
+func BenchmarkUnmarshalLogicPkt(b *testing.B) {
+	data := Marshal(newTestPkt())[4:]
+	var p LogicPkt
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = UnmarshalLogicPkt(data, &p)
+	}
+}
@@ -118,9 +118,12 @@ func (Flag) EnumDescriptor() ([]byte, []int) {
 type MetaType int32
 
 const (
-	MetaType_int    MetaType = 0
-	MetaType_string MetaType = 1
-	MetaType_float  MetaType = 2
+	MetaType_int     MetaType = 0
+	MetaType_string  MetaType = 1
+	MetaType_float   MetaType = 2
+	MetaType_bool    MetaType = 3
+	MetaType_bytes   MetaType = 4 // base64 encoded
+	MetaType_strings MetaType = 5 // JSON array of strings
 )
 
 // Enum value maps for MetaType.
@@ -129,11 +132,17 @@ var (
 		0: "int",
 		1: "string",
 		2: "float",
+		3: "bool",
+		4: "bytes",
+		5: "strings",
 	}
 	MetaType_value = map[string]int32{
-		"int":    0,
-		"string": 1,
-		"float":  2,
+		"int":     0,
+		"string":  1,
+		"float":   2,
+		"bool":    3,
+		"bytes":   4,
+		"strings": 5,
 	}
 )
 
@@ -528,21 +537,23 @@ var file_common_proto_rawDesc = []byte{
 	0x12, 0x08, 0x0a, 0x04, 0x4a, 0x73, 0x6f, 0x6e, 0x10, 0x01, 0x2a, 0x2b, 0x0a, 0x04, 0x46, 0x6c,
 	0x61, 0x67, 0x12, 0x0b, 0x0a, 0x07, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x10, 0x00, 0x12,
 	0x0c, 0x0a, 0x08, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x10, 0x01, 0x12, 0x08, 0x0a,
-	0x04, 0x50, 0x75, 0x73, 0x68, 0x10, 0x02, 0x2a, 0x2a, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x54,
+	0x04, 0x50, 0x75, 0x73, 0x68, 0x10, 0x02, 0x2a, 0x4c, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x54,
 	0x79, 0x70, 0x65, 0x12, 0x07, 0x0a, 0x03, 0x69, 0x6e, 0x74, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06,
 	0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x66, 0x6c, 0x6f, 0x61,
-	0x74, 0x10, 0x02, 0x2a, 0xa6, 0x01, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b,
-	0x0a, 0x07, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x10, 0x00, 0x12, 0x11, 0x0a, 0x0d, 0x4e,
-	0x6f, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x10, 0x64, 0x12, 0x15,
-	0x0a, 0x11, 0x49, 0x6e, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x42,
-	0x6f, 0x64, 0x79, 0x10, 0x65, 0x12, 0x12, 0x0a, 0x0e, 0x49, 0x6e, 0x76, 0x61, 0x6c, 0x69, 0x64,
-	0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x10, 0x67, 0x12, 0x10, 0x0a, 0x0c, 0x55, 0x6e, 0x61,
-	0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x7a, 0x65, 0x64, 0x10, 0x69, 0x12, 0x14, 0x0a, 0x0f, 0x53,
-	0x79, 0x73, 0x74, 0x65, 0x6d, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x10, 0xac,
-	0x02, 0x12, 0x13, 0x0a, 0x0e, 0x4e, 0x6f, 0x74, 0x49, 0x6d, 0x70, 0x6c, 0x65, 0x6d, 0x65, 0x6e,
-	0x74, 0x65, 0x64, 0x10, 0xad, 0x02, 0x12, 0x14, 0x0a, 0x0f, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f,
-	0x6e, 0x4e, 0x6f, 0x74, 0x46, 0x6f, 0x75, 0x6e, 0x64, 0x10, 0x94, 0x03, 0x42, 0x07, 0x5a, 0x05,
-	0x2e, 0x2f, 0x70, 0x6b, 0x74, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x74, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x62, 0x6f, 0x6f, 0x6c, 0x10, 0x03, 0x12, 0x09, 0x0a,
+	0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x10, 0x04, 0x12, 0x0b, 0x0a, 0x07, 0x73, 0x74, 0x72, 0x69,
+	0x6e, 0x67, 0x73, 0x10, 0x05, 0x2a, 0xa6, 0x01, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x12, 0x0b, 0x0a, 0x07, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x10, 0x00, 0x12, 0x11, 0x0a,
+	0x0d, 0x4e, 0x6f, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x10, 0x64,
+	0x12, 0x15, 0x0a, 0x11, 0x49, 0x6e, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x65,
+	0x74, 0x42, 0x6f, 0x64, 0x79, 0x10, 0x65, 0x12, 0x12, 0x0a, 0x0e, 0x49, 0x6e, 0x76, 0x61, 0x6c,
+	0x69, 0x64, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x10, 0x67, 0x12, 0x10, 0x0a, 0x0c, 0x55,
+	0x6e, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x7a, 0x65, 0x64, 0x10, 0x69, 0x12, 0x14, 0x0a,
+	0x0f, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x10, 0xac, 0x02, 0x12, 0x13, 0x0a, 0x0e, 0x4e, 0x6f, 0x74, 0x49, 0x6d, 0x70, 0x6c, 0x65, 0x6d,
+	0x65, 0x6e, 0x74, 0x65, 0x64, 0x10, 0xad, 0x02, 0x12, 0x14, 0x0a, 0x0f, 0x53, 0x65, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x4e, 0x6f, 0x74, 0x46, 0x6f, 0x75, 0x6e, 0x64, 0x10, 0x94, 0x03, 0x42, 0x07,
+	0x5a, 0x05, 0x2e, 0x2f, 0x70, 0x6b, 0x74, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -0,0 +1,157 @@
+package pkt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"sync"
+)
+
+// CompressThreshold is the body size above which WriteBody compresses
+var CompressThreshold = 1024
+
+// maxDecompressedSize limits the memory of decompressing a body from
+// untrusted input
+const maxDecompressedSize = 64 << 20
+
+var ErrBodyTooLarge = errors.New("decompressed body is too large")
+
+// Compressor compresses bodies of packets
+type Compressor interface {
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var compressors = struct {
+	sync.RWMutex
+	m map[string]Compressor
+}{
+	m: map[string]Compressor{
+		wire.CompressionZstd:   newZstdCompressor(),
+		wire.CompressionSnappy: snappyCompressor{},
+	},
+}
+
+// RegisterCompressor adds or replaces the compressor of algorithm
+func RegisterCompressor(algorithm string, c Compressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.m[algorithm] = c
+}
+
+// Compressors returns the supported algorithms
+func Compressors() []string {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	algorithms := make([]string, 0, len(compressors.m))
+	for a := range compressors.m {
+		algorithms = append(algorithms, a)
+	}
+	return algorithms
+}
+
+func compressorOf(algorithm string) (Compressor, error) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	c, ok := compressors.m[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("compression %s is not supported", algorithm)
+	}
+	return c, nil
+}
+
+// Compression of body, it is carried by meta wire.MetaCompression
+// and is empty if body is not compressed
+func (p *LogicPkt) Compression() string {
+	v, ok := p.GetMeta(wire.MetaCompression)
+	if !ok {
+		return ""
+	}
+	algorithm, _ := v.(string)
+	return algorithm
+}
+
+// SetCompression sets the algorithm WriteBody compresses bodies larger
+// than CompressThreshold in, it is usually negotiated with SDK
+func (p *LogicPkt) SetCompression(algorithm string) {
+	p.compression = algorithm
+}
+
+// CompressBody converts the body to algorithm, the body is left raw
+// if it is not larger than CompressThreshold or algorithm is empty
+func (p *LogicPkt) CompressBody(algorithm string) error {
+	if p.Compression() == algorithm {
+		return nil
+	}
+	body, err := p.rawBody()
+	if err != nil {
+		return err
+	}
+	p.DelMeta(wire.MetaCompression)
+	p.Body = body
+	if algorithm == "" || len(body) <= CompressThreshold {
+		return nil
+	}
+	c, err := compressorOf(algorithm)
+	if err != nil {
+		return err
+	}
+	p.Body, err = c.Compress(body)
+	if err != nil {
+		return err
+	}
+	p.SetStringMeta(wire.MetaCompression, algorithm)
+	return nil
+}
+
+// rawBody returns the body decompressed
+func (p *LogicPkt) rawBody() ([]byte, error) {
+	algorithm := p.Compression()
+	if algorithm == "" {
+		return p.Body, nil
+	}
+	c, err := compressorOf(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decompress(p.Body)
+}
+
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor() *zstdCompressor {
+	// EncodeAll and DecodeAll are safe for concurrent use
+	encoder, _ := zstd.NewWriter(nil)
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	return &zstdCompressor{encoder: encoder, decoder: decoder}
+}
+
+func (z *zstdCompressor) Compress(src []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(src, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(src []byte) ([]byte, error) {
+	return z.decoder.DecodeAll(src, nil)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(src []byte) ([]byte, error) {
+	return s2.EncodeSnappy(nil, src), nil
+}
+
+func (snappyCompressor) Decompress(src []byte) ([]byte, error) {
+	n, err := s2.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxDecompressedSize {
+		return nil, ErrBodyTooLarge
+	}
+	return s2.Decode(nil, src)
+}
@@ -0,0 +1,51 @@
+package pkt
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"testing"
+)
+
+func TestCompressBody(t *testing.T) {
+	for _, algorithm := range []string{wire.CompressionZstd, wire.CompressionSnappy} {
+		p := New("chat.offline.content")
+		p.SetCompression(algorithm)
+		// a small body is left raw
+		p.WriteBody(&ErrorResp{Message: "hello"})
+		assert.Equal(t, "", p.Compression())
+
+		message := string(bytes.Repeat([]byte("hello"), 1000))
+		p.WriteBody(&ErrorResp{Message: message})
+		assert.Equal(t, algorithm, p.Compression())
+		assert.Less(t, len(p.Body), len(message))
+
+		// compression is kept by encoding
+		var p2 LogicPkt
+		assert.Nil(t, p2.Decode(bytes.NewBuffer(Marshal(p)[4:])))
+		var resp ErrorResp
+		assert.Nil(t, p2.ReadBody(&resp))
+		assert.Equal(t, message, resp.Message)
+
+		// decompress
+		assert.Nil(t, p2.CompressBody(""))
+		assert.Equal(t, "", p2.Compression())
+		assert.Nil(t, p2.ReadBody(&resp))
+		assert.Equal(t, message, resp.Message)
+	}
+
+	p := New("chat.offline.content")
+	p.Body = bytes.Repeat([]byte("hello"), 1000)
+	assert.NotNil(t, p.CompressBody("gzip"))
+	p.AddStringMeta(wire.MetaCompression, "gzip")
+	assert.NotNil(t, p.ReadBody(&ErrorResp{}))
+}
+
+func TestDecompressBomb(t *testing.T) {
+	p := New("chat.user.talk")
+	p.SetStringMeta(wire.MetaCompression, wire.CompressionSnappy)
+	// the header of snappy claims a body of 4GB
+	p.Body = []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}
+	var req LoginReq
+	assert.Equal(t, ErrBodyTooLarge, p.ReadBody(&req))
+}
@@ -0,0 +1,83 @@
+package pkt
+
+import (
+	"bytes"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"testing"
+)
+
+func fuzzSeeds(f *testing.F) {
+	logic := New("chat.user.talk", WithSeq(1), WithDest("test2"))
+	logic.SetStringMeta(wire.MetaDestServer, "gateway01")
+	logic.Body = []byte("hello")
+	data := Marshal(logic)
+	f.Add(data)
+	f.Add(data[:len(data)-2])
+	f.Add(data[:6])
+	compressed := New("chat.user.talk")
+	compressed.SetStringMeta(wire.MetaCompression, wire.CompressionSnappy)
+	compressed.Body = []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}
+	f.Add(Marshal(compressed))
+	f.Add(Marshal(&BasicPkt{Code: CodePing}))
+	f.Add(Marshal(&BasicPkt{Code: CodePong, Length: 2, Body: []byte{1, 2}}))
+	// truncated body of basic packet
+	f.Add(append(wire.MagicBasicPkt[:], 0, 1, 0, 9, 1))
+	// huge length prefixes of header and body
+	f.Add(append(wire.MagicLogicPkt[:], 0xff, 0xff, 0xff, 0xff, 1))
+	f.Add(append(wire.MagicLogicPkt[:], 0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff))
+	f.Add([]byte{0xc3, 0x11})
+	f.Add([]byte{})
+}
+
+func FuzzRead(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := Read(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// a decoded packet must be decoded in the same by Unmarshal
+		if _, err = Unmarshal(data); err != nil {
+			t.Fatalf("Read succeeds but Unmarshal fails: %v", err)
+		}
+		p2, err := Read(bytes.NewReader(Marshal(p.(Packet))))
+		if err != nil {
+			t.Fatalf("packet is not decoded after encoding: %v", err)
+		}
+		if lp, ok := p.(*LogicPkt); ok && !bytes.Equal(lp.Body, p2.(*LogicPkt).Body) {
+			t.Fatalf("body is changed in round trip")
+		}
+	})
+}
+
+func FuzzLogicPktDecode(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p LogicPkt
+		if err := p.Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+		// meta of packets from clients are read by gateway and services
+		for _, m := range p.Meta {
+			_, _ = DecodeMeta(m)
+		}
+		_ = p.ContentType()
+		_ = p.Compression()
+		_ = p.ServiceName()
+		var body ErrorResp
+		_ = p.ReadBody(&body)
+	})
+}
+
+func FuzzBasicPktDecode(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p BasicPkt
+		if err := p.Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+		if int(p.Length) != len(p.Body) {
+			t.Fatalf("length %d of basic packet is not equal to body %d", p.Length, len(p.Body))
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package pkt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"github.com/wangxuefeng90923/wxf/wire/endian"
+	"hash"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNotSigned        = errors.New("packet is not signed")
+	ErrInvalidSignature = errors.New("signature of packet is invalid")
+)
+
+// Sign sets the timestamp of p and its HMAC-SHA256 signature keyed by
+// secret, it must be called after the body is written
+func (p *LogicPkt) Sign(secret []byte) {
+	p.SetIntMeta(wire.MetaTimestamp, time.Now().UnixMilli())
+	p.SetBytesMeta(wire.MetaSignature, p.signature(secret))
+}
+
+// Verify checks the signature of p by secret
+func (p *LogicPkt) Verify(secret []byte) error {
+	sign, err := p.GetBytesMeta(wire.MetaSignature)
+	if err != nil {
+		return ErrNotSigned
+	}
+	if !hmac.Equal(sign, p.signature(secret)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Timestamp returns the time when p is signed
+func (p *LogicPkt) Timestamp() (time.Time, error) {
+	ms, err := p.GetIntMeta(wire.MetaTimestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// signed reports whether meta m is signed, the content type of packets
+// read from text frames is not signed as it is always set to JSON by
+// ReadTextPkt
+func (p *LogicPkt) signed(m *Meta) bool {
+	switch m.Key {
+	case wire.MetaSignature:
+		return false
+	case wire.MetaContentType:
+		return !p.text
+	}
+	return true
+}
+
+// signature is the HMAC of command, sequence, flag, status, dest, meta
+// sorted by key, and body. ChannelId is not signed as it is set by
+// gateway
+func (p *LogicPkt) signature(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	_ = endian.WriteString(mac, p.Command)
+	_ = endian.WriteUint32(mac, p.Sequence)
+	_ = endian.WriteUint32(mac, uint32(p.Flag))
+	_ = endian.WriteUint32(mac, uint32(p.Status))
+	_ = endian.WriteString(mac, p.Dest)
+	meta := make([]*Meta, 0, len(p.Meta))
+	for _, m := range p.Meta {
+		if p.signed(m) {
+			meta = append(meta, m)
+		}
+	}
+	sort.Slice(meta, func(i, j int) bool {
+		return meta[i].Key < meta[j].Key
+	})
+	for _, m := range meta {
+		writeMeta(mac, m)
+	}
+	_ = endian.WriteBytes(mac, p.Body)
+	return mac.Sum(nil)
+}
+
+func writeMeta(h hash.Hash, m *Meta) {
+	_ = endian.WriteString(h, m.Key)
+	_ = endian.WriteUint32(h, uint32(m.Type))
+	_ = endian.WriteString(h, m.Value)
+}
@@ -0,0 +1,86 @@
+package pkt
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/wangxuefeng90923/wxf/wire"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	p := New("chat.user.talk", WithSeq(3), WithDest("test2"))
+	p.WriteBody(&ErrorResp{Message: "hello"})
+	assert.Equal(t, ErrNotSigned, p.Verify(secret))
+
+	p.Sign(secret)
+	// the signature is kept by encoding, and channel is not signed
+	p2, err := MustReadLogicPkt(bytes.NewBuffer(Marshal(p)))
+	assert.Nil(t, err)
+	p2.ChannelId = "gateway01_test1_1"
+	assert.Nil(t, p2.Verify(secret))
+	assert.Equal(t, ErrInvalidSignature, p2.Verify([]byte("other")))
+	ts, err := p2.Timestamp()
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now(), ts, time.Second)
+
+	p2.Body = append(p2.Body, 0)
+	assert.Equal(t, ErrInvalidSignature, p2.Verify(secret))
+	p2.Body = p2.Body[:len(p2.Body)-1]
+	p2.SetIntMeta(wire.MetaTimestamp, ts.Add(time.Hour).UnixMilli())
+	assert.Equal(t, ErrInvalidSignature, p2.Verify(secret))
+}
+
+func TestSignContentType(t *testing.T) {
+	secret := []byte("secret")
+	p := New("chat.user.talk", WithSeq(3))
+	p.WriteBody(&ErrorResp{Message: "hello"})
+	p.Sign(secret)
+
+	// the content type of binary packets can not be flipped
+	p2, err := MustReadLogicPkt(bytes.NewBuffer(Marshal(p)))
+	assert.Nil(t, err)
+	p2.SetContentType(ContentType_Json)
+	assert.Equal(t, ErrInvalidSignature, p2.Verify(secret))
+
+	p = New("chat.user.talk", WithSeq(4), WithContentType(ContentType_Json))
+	p.Body = []byte(`{"message":"hello"}`)
+	p.Sign(secret)
+	p2, err = MustReadLogicPkt(bytes.NewBuffer(Marshal(p)))
+	assert.Nil(t, err)
+	assert.Nil(t, p2.Verify(secret))
+	p2.SetContentType(ContentType_Protobuf)
+	assert.Equal(t, ErrInvalidSignature, p2.Verify(secret))
+
+	// a reused packet read from a text frame before signs its content type
+	p2.text = true
+	assert.Nil(t, UnmarshalLogicPkt(Marshal(p)[4:], p2))
+	assert.False(t, p2.text)
+}
+
+func TestSignText(t *testing.T) {
+	secret := []byte("secret")
+	p := New("chat.user.talk", WithSeq(3))
+	p.AddStringMeta("app", "wxf")
+	p.Body = []byte(`{"message":"hello"}`)
+	p.Sign(secret)
+
+	// meta are signed regardless of their order
+	p.Meta[0], p.Meta[len(p.Meta)-1] = p.Meta[len(p.Meta)-1], p.Meta[0]
+	assert.Nil(t, p.Verify(secret))
+
+	// the content type is set by gateway after the packet is signed
+	text, err := json.Marshal(&TextPkt{
+		Command:  p.Command,
+		Sequence: p.Sequence,
+		Meta:     p.Meta,
+		Body:     p.Body,
+	})
+	assert.Nil(t, err)
+	p2, err := ReadTextPkt(text)
+	assert.Nil(t, err)
+	assert.Equal(t, ContentType_Json, p2.ContentType())
+	assert.Nil(t, p2.Verify(secret))
+}
@@ -0,0 +1,169 @@
+package pkt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrMetaNotFound = errors.New("meta not found")
+
+// DecodeMeta returns the value of m by its type: int, string, float64,
+// bool, []byte or []string
+func DecodeMeta(m *Meta) (any, error) {
+	switch m.Type {
+	case MetaType_int:
+		return strconv.Atoi(m.Value)
+	case MetaType_float:
+		return strconv.ParseFloat(m.Value, 64)
+	case MetaType_bool:
+		return strconv.ParseBool(m.Value)
+	case MetaType_bytes:
+		return base64.StdEncoding.DecodeString(m.Value)
+	case MetaType_strings:
+		var arr []string
+		err := json.Unmarshal([]byte(m.Value), &arr)
+		return arr, err
+	}
+	return m.Value, nil
+}
+
+// AddMeta appends m to meta, an existing meta of the same key is found
+// first, use SetMeta to replace it
+func (x *Header) AddMeta(m ...*Meta) {
+	x.Meta = append(x.Meta, m...)
+}
+
+func (x *Header) AddStringMeta(key, value string) {
+	x.AddMeta(&Meta{
+		Key:   key,
+		Value: value,
+		Type:  MetaType_string,
+	})
+}
+
+// DelMeta deletes all meta of key
+func (x *Header) DelMeta(key string) {
+	meta := x.Meta[:0]
+	for _, m := range x.Meta {
+		if m.Key != key {
+			meta = append(meta, m)
+		}
+	}
+	for i := len(meta); i < len(x.Meta); i++ {
+		x.Meta[i] = nil
+	}
+	x.Meta = meta
+}
+
+// SetMeta replaces the meta of the same key with m in place, or appends m
+// if the key is not found. duplicates from a decoded packet are deleted
+func (x *Header) SetMeta(m *Meta) {
+	for i, old := range x.Meta {
+		if old.Key != m.Key {
+			continue
+		}
+		// meta before i are of other keys, so m is put back to i
+		x.DelMeta(m.Key)
+		x.Meta = append(x.Meta, nil)
+		copy(x.Meta[i+1:], x.Meta[i:])
+		x.Meta[i] = m
+		return
+	}
+	x.Meta = append(x.Meta, m)
+}
+
+func (x *Header) SetStringMeta(key, value string) {
+	x.SetMeta(&Meta{Key: key, Value: value, Type: MetaType_string})
+}
+
+func (x *Header) SetIntMeta(key string, value int64) {
+	x.SetMeta(&Meta{Key: key, Value: strconv.FormatInt(value, 10), Type: MetaType_int})
+}
+
+func (x *Header) SetFloatMeta(key string, value float64) {
+	x.SetMeta(&Meta{Key: key, Value: strconv.FormatFloat(value, 'g', -1, 64), Type: MetaType_float})
+}
+
+func (x *Header) SetBoolMeta(key string, value bool) {
+	x.SetMeta(&Meta{Key: key, Value: strconv.FormatBool(value), Type: MetaType_bool})
+}
+
+func (x *Header) SetBytesMeta(key string, value []byte) {
+	x.SetMeta(&Meta{Key: key, Value: base64.StdEncoding.EncodeToString(value), Type: MetaType_bytes})
+}
+
+func (x *Header) SetStringsMeta(key string, value []string) {
+	if value == nil {
+		value = []string{}
+	}
+	data, _ := json.Marshal(value)
+	x.SetMeta(&Meta{Key: key, Value: string(data), Type: MetaType_strings})
+}
+
+// lookupMeta returns the meta of key in type t, the first one is used
+// if a decoded packet carries duplicates, the same as FindMeta
+func (x *Header) lookupMeta(key string, t MetaType) (*Meta, error) {
+	for _, m := range x.Meta {
+		if m.Key != key {
+			continue
+		}
+		if m.Type != t {
+			return nil, fmt.Errorf("meta %s is %s, not %s", key, m.Type, t)
+		}
+		return m, nil
+	}
+	return nil, ErrMetaNotFound
+}
+
+func (x *Header) GetStringMeta(key string) (string, error) {
+	m, err := x.lookupMeta(key, MetaType_string)
+	if err != nil {
+		return "", err
+	}
+	return m.Value, nil
+}
+
+func (x *Header) GetIntMeta(key string) (int64, error) {
+	m, err := x.lookupMeta(key, MetaType_int)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(m.Value, 10, 64)
+}
+
+func (x *Header) GetFloatMeta(key string) (float64, error) {
+	m, err := x.lookupMeta(key, MetaType_float)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(m.Value, 64)
+}
+
+func (x *Header) GetBoolMeta(key string) (bool, error) {
+	m, err := x.lookupMeta(key, MetaType_bool)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(m.Value)
+}
+
+func (x *Header) GetBytesMeta(key string) ([]byte, error) {
+	m, err := x.lookupMeta(key, MetaType_bytes)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(m.Value)
+}
+
+func (x *Header) GetStringsMeta(key string) ([]string, error) {
+	m, err := x.lookupMeta(key, MetaType_strings)
+	if err != nil {
+		return nil, err
+	}
+	var arr []string
+	err = json.Unmarshal([]byte(m.Value), &arr)
+	return arr, err
+}
@@ -0,0 +1,97 @@
+package pkt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTypedMeta(t *testing.T) {
+	var h Header
+	h.SetStringMeta("s", "v1")
+	h.SetIntMeta("i", -42)
+	h.SetFloatMeta("f", 1.5)
+	h.SetBoolMeta("b", true)
+	h.SetBytesMeta("bs", []byte{0, 1, 255})
+	h.SetStringsMeta("ss", []string{"a", "b,c"})
+
+	s, err := h.GetStringMeta("s")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", s)
+	i, err := h.GetIntMeta("i")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-42), i)
+	f, err := h.GetFloatMeta("f")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+	b, err := h.GetBoolMeta("b")
+	assert.Nil(t, err)
+	assert.True(t, b)
+	bs, err := h.GetBytesMeta("bs")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 255}, bs)
+	ss, err := h.GetStringsMeta("ss")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b,c"}, ss)
+
+	_, err = h.GetStringMeta("none")
+	assert.Equal(t, ErrMetaNotFound, err)
+	_, err = h.GetIntMeta("s")
+	assert.NotNil(t, err)
+
+	v, ok := FindMeta(h.Meta, "i")
+	assert.True(t, ok)
+	assert.Equal(t, -42, v)
+	v, ok = FindMeta(h.Meta, "ss")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b,c"}, v)
+}
+
+func TestAddMeta(t *testing.T) {
+	var h Header
+	h.AddStringMeta("k", "v1")
+	h.AddStringMeta("k", "v2")
+	// meta are appended, and the first one is found
+	assert.Equal(t, 2, len(h.Meta))
+	s, _ := h.GetStringMeta("k")
+	assert.Equal(t, "v1", s)
+	h.SetStringMeta("k", "v3")
+	assert.Equal(t, 1, len(h.Meta))
+	assert.Equal(t, "v3", h.Meta[0].Value)
+}
+
+func TestSetMeta(t *testing.T) {
+	var h Header
+	h.SetStringMeta("k", "v1")
+	h.SetStringMeta("other", "o")
+	h.SetStringMeta("k", "v2")
+	// keys are unique, the meta is replaced in place
+	assert.Equal(t, 2, len(h.Meta))
+	assert.Equal(t, "k", h.Meta[0].Key)
+	s, _ := h.GetStringMeta("k")
+	assert.Equal(t, "v2", s)
+	h.SetStringMeta("k", "v3")
+	assert.Equal(t, 2, len(h.Meta))
+	assert.Equal(t, "v3", h.Meta[0].Value)
+
+	// duplicates of a decoded packet are resolved in the same way
+	h.Meta = append(h.Meta, &Meta{Key: "k", Value: "v4"})
+	s, _ = h.GetStringMeta("k")
+	assert.Equal(t, "v3", s)
+	v, _ := FindMeta(h.Meta, "k")
+	assert.Equal(t, "v3", v)
+	h.SetStringMeta("k", "v5")
+	assert.Equal(t, 2, len(h.Meta))
+	assert.Equal(t, "v5", h.Meta[0].Value)
+	assert.Equal(t, "other", h.Meta[1].Key)
+
+	h.DelMeta("k")
+	assert.Equal(t, 1, len(h.Meta))
+	assert.Equal(t, "other", h.Meta[0].Key)
+
+	// invalid values are not found
+	h.AddMeta(&Meta{Key: "bad", Value: "x", Type: MetaType_int})
+	_, ok := FindMeta(h.Meta, "bad")
+	assert.False(t, ok)
+	_, err := h.GetIntMeta("bad")
+	assert.NotNil(t, err)
+}
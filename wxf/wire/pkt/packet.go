@@ -4,6 +4,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/wangxuefeng90923/wxf/wire"
 	"github.com/wangxuefeng90923/wxf/wire/endian"
+	"google.golang.org/protobuf/encoding/protojson"
 	"io"
 	"strconv"
 	"strings"
@@ -12,6 +13,10 @@ import (
 type LogicPkt struct {
 	Header
 	Body []byte `json:"body,omitempty"`
+	// compression is the algorithm of WriteBody, see SetCompression
+	compression string
+	// text is set if p is read from a TextPkt
+	text bool
 }
 
 type HeaderOption func(*Header)
@@ -50,47 +55,23 @@ func (p *LogicPkt) GetMeta(key string) (any, bool) {
 	return FindMeta(p.Meta, key)
 }
 
+// FindMeta returns the value of key decoded by its type, values of
+// MetaType_int are int. It returns false if the value is invalid,
+// use the typed getters of Header to get the error. the first one
+// is used if meta carries duplicates, the same as the typed getters
 func FindMeta(meta []*Meta, key string) (any, bool) {
 	for _, m := range meta {
 		if m.Key == key {
-			switch m.Type {
-			case MetaType_int:
-				v, _ := strconv.Atoi(m.Value)
-				return v, true
-			case MetaType_float:
-				v, _ := strconv.ParseFloat(m.Value, 64)
-				return v, true
+			v, err := DecodeMeta(m)
+			if err != nil {
+				return nil, false
 			}
-			return m.Value, true
+			return v, true
 		}
 	}
 	return nil, false
 }
 
-func (p *LogicPkt) DelMeta(key string) {
-	for i, m := range p.Meta {
-		if m.Key == key {
-			length := len(p.Meta)
-			if i < length-1 {
-				copy(p.Meta[i:], p.Meta[i+1:])
-			}
-			p.Meta = p.Meta[:length-1]
-		}
-	}
-}
-
-func (p *LogicPkt) AddStringMeta(key, value string) {
-	p.AddMeta(&Meta{
-		Key:   key,
-		Value: value,
-		Type:  MetaType_string,
-	})
-}
-
-func (p *LogicPkt) AddMeta(m ...*Meta) {
-	p.Meta = append(p.Meta, m...)
-}
-
 func (x *Header) ServiceName() string {
 	arr := strings.SplitN(x.Command, ".", 2)
 	if len(arr) <= 1 {
@@ -124,15 +105,55 @@ func NewFrom(header *Header) *LogicPkt {
 	return pkt
 }
 
+// ContentType of body, it is carried by meta wire.MetaContentType
+// and is ContentType_Protobuf if absent
+func (p *LogicPkt) ContentType() ContentType {
+	v, ok := p.GetMeta(wire.MetaContentType)
+	if !ok {
+		return ContentType_Protobuf
+	}
+	ct, _ := v.(int)
+	return ContentType(ct)
+}
+
+func (p *LogicPkt) SetContentType(ct ContentType) {
+	if ct == ContentType_Protobuf {
+		p.DelMeta(wire.MetaContentType)
+		return
+	}
+	p.SetIntMeta(wire.MetaContentType, int64(ct))
+}
+
+var jsonUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// ReadBody unmarshal body in the content type of packet,
+// a compressed body is decompressed first
 func (p *LogicPkt) ReadBody(val proto.Message) error {
-	return proto.Unmarshal(p.Body, val)
+	body, err := p.rawBody()
+	if err != nil {
+		return err
+	}
+	if p.ContentType() == ContentType_Json {
+		return jsonUnmarshal.Unmarshal(body, proto.MessageV2(val))
+	}
+	return proto.Unmarshal(body, val)
 }
 
+// WriteBody marshal val in the content type of packet, and compress
+// it if a compression is set
 func (p *LogicPkt) WriteBody(val proto.Message) *LogicPkt {
 	if val == nil {
 		return p
 	}
-	p.Body, _ = proto.Marshal(val)
+	p.DelMeta(wire.MetaCompression)
+	if p.ContentType() == ContentType_Json {
+		p.Body, _ = protojson.Marshal(proto.MessageV2(val))
+	} else {
+		p.Body, _ = proto.Marshal(val)
+	}
+	if p.compression != "" {
+		_ = p.CompressBody(p.compression)
+	}
 	return p
 }
 
@@ -154,6 +175,18 @@ func WithChannel(channelID string) HeaderOption {
 	}
 }
 
+func WithContentType(ct ContentType) HeaderOption {
+	return func(h *Header) {
+		if ct != ContentType_Protobuf {
+			h.Meta = append(h.Meta, &Meta{
+				Key:   wire.MetaContentType,
+				Value: strconv.Itoa(int(ct)),
+				Type:  MetaType_int,
+			})
+		}
+	}
+}
+
 func WithDest(dest string) HeaderOption {
 	return func(h *Header) {
 		h.Dest = dest
@@ -0,0 +1,58 @@
+package pkt
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestJsonBody(t *testing.T) {
+	p := New("login.signin", WithContentType(ContentType_Json))
+	assert.Equal(t, ContentType_Json, p.ContentType())
+	p.WriteBody(&LoginReq{Token: "token1", Isp: "isp"})
+	assert.Equal(t, byte('{'), p.Body[0])
+
+	// content type is kept by encoding
+	buf := new(bytes.Buffer)
+	assert.Nil(t, p.Encode(buf))
+	var p2 LogicPkt
+	assert.Nil(t, p2.Decode(buf))
+	assert.Equal(t, ContentType_Json, p2.ContentType())
+
+	var req LoginReq
+	assert.Nil(t, p2.ReadBody(&req))
+	assert.Equal(t, "token1", req.Token)
+	assert.Equal(t, "isp", req.Isp)
+
+	// unknown fields of web clients are discarded
+	p2.Body = []byte(`{"token":"token2","unknown":1}`)
+	assert.Nil(t, p2.ReadBody(&req))
+	assert.Equal(t, "token2", req.Token)
+}
+
+func TestProtobufBody(t *testing.T) {
+	p := New("login.signin")
+	assert.Equal(t, ContentType_Protobuf, p.ContentType())
+	p.WriteBody(&LoginReq{Token: "token1"})
+
+	var req LoginReq
+	assert.Nil(t, p.ReadBody(&req))
+	assert.Equal(t, "token1", req.Token)
+
+	p.SetContentType(ContentType_Json)
+	p.SetContentType(ContentType_Json)
+	assert.Equal(t, 1, len(p.Meta))
+	p.SetContentType(ContentType_Protobuf)
+	assert.Equal(t, 0, len(p.Meta))
+}
+
+func TestAck(t *testing.T) {
+	packet, err := MustReadBasicPkt(bytes.NewBuffer(Marshal(NewAck(1 << 31))))
+	assert.Nil(t, err)
+	seq, err := packet.AckSequence()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1<<31), seq)
+
+	_, err = (&BasicPkt{Code: CodePong}).AckSequence()
+	assert.Equal(t, ErrInvalidAck, err)
+}
@@ -0,0 +1,104 @@
+package pkt
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TextPkt is the JSON envelope of LogicPkt in websocket text frames,
+// which is used by browser clients. it is a BasicPkt if Code is set,
+// e.g. {"code":1} is a ping, and the sequence of an ack is in Sequence
+type TextPkt struct {
+	Code     uint16  `json:"code,omitempty"`
+	Command  string  `json:"command,omitempty"`
+	Sequence uint32  `json:"sequence,omitempty"`
+	Flag     Flag    `json:"flag,omitempty"`
+	Status   Status  `json:"status,omitempty"`
+	Dest     string  `json:"dest,omitempty"`
+	Meta     []*Meta `json:"meta,omitempty"`
+	// Body is a JSON object, or a base64 string if the body of LogicPkt
+	// is not in ContentType_Json
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// ReadText decodes a TextPkt into BasicPkt if its code is set, or into
+// LogicPkt like ReadTextPkt
+func ReadText(data []byte) (interface{}, error) {
+	var text TextPkt
+	if err := json.Unmarshal(data, &text); err != nil {
+		return nil, err
+	}
+	if text.Code == 0 {
+		return newTextPkt(&text)
+	}
+	if text.Code == CodeAck {
+		return NewAck(text.Sequence), nil
+	}
+	return &BasicPkt{Code: text.Code}, nil
+}
+
+// ReadTextPkt decodes a TextPkt into LogicPkt, its body is in ContentType_Json
+func ReadTextPkt(data []byte) (*LogicPkt, error) {
+	var text TextPkt
+	if err := json.Unmarshal(data, &text); err != nil {
+		return nil, err
+	}
+	return newTextPkt(&text)
+}
+
+func newTextPkt(text *TextPkt) (*LogicPkt, error) {
+	if text.Command == "" {
+		return nil, fmt.Errorf("command of text packet is empty")
+	}
+	p := &LogicPkt{
+		Header: Header{
+			Command:  text.Command,
+			Sequence: text.Sequence,
+			Flag:     text.Flag,
+			Status:   text.Status,
+			Dest:     text.Dest,
+			Meta:     text.Meta,
+		},
+		Body: text.Body,
+		text: true,
+	}
+	p.SetContentType(ContentType_Json)
+	return p, nil
+}
+
+// MarshalBasicText encodes p into a TextPkt with its code
+func MarshalBasicText(p *BasicPkt) ([]byte, error) {
+	text := TextPkt{Code: p.Code}
+	if p.Code == CodeAck {
+		seq, err := p.AckSequence()
+		if err != nil {
+			return nil, err
+		}
+		text.Sequence = seq
+	}
+	return json.Marshal(&text)
+}
+
+// MarshalText encodes p into a TextPkt
+func MarshalText(p *LogicPkt) ([]byte, error) {
+	text := TextPkt{
+		Command:  p.Command,
+		Sequence: p.Sequence,
+		Flag:     p.Flag,
+		Status:   p.Status,
+		Dest:     p.Dest,
+		Meta:     p.Meta,
+	}
+	if len(p.Body) > 0 {
+		if p.ContentType() == ContentType_Json {
+			text.Body = p.Body
+		} else {
+			body, err := json.Marshal(p.Body)
+			if err != nil {
+				return nil, err
+			}
+			text.Body = body
+		}
+	}
+	return json.Marshal(&text)
+}
@@ -0,0 +1,70 @@
+package pkt
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTextPkt(t *testing.T) {
+	p, err := ReadTextPkt([]byte(`{"command":"login.signin","sequence":3,"dest":"test2","meta":[{"key":"app","value":"im","type":1}],"body":{"token":"hello"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "login.signin", p.Command)
+	assert.Equal(t, uint32(3), p.Sequence)
+	assert.Equal(t, "test2", p.Dest)
+	assert.Equal(t, ContentType_Json, p.ContentType())
+	app, _ := p.GetMeta("app")
+	assert.Equal(t, "im", app)
+
+	var req LoginReq
+	assert.Nil(t, p.ReadBody(&req))
+	assert.Equal(t, "hello", req.Token)
+
+	// a response in JSON keeps its body as an object
+	resp := NewFrom(&p.Header)
+	resp.Flag = Flag_Response
+	resp.SetContentType(ContentType_Json)
+	resp.WriteBody(&LoginResp{Account: "test1"})
+	text, err := MarshalText(resp)
+	assert.Nil(t, err)
+	var out struct {
+		Flag int
+		Body map[string]string
+	}
+	assert.Nil(t, json.Unmarshal(text, &out))
+	assert.Equal(t, 1, out.Flag)
+	assert.Equal(t, "test1", out.Body["account"])
+
+	// a protobuf body is encoded in base64
+	resp = NewFrom(&p.Header)
+	resp.Body = []byte{1, 2}
+	text, err = MarshalText(resp)
+	assert.Nil(t, err)
+	assert.Contains(t, string(text), `"body":"AQI="`)
+
+	_, err = ReadTextPkt([]byte(`{"sequence":1}`))
+	assert.NotNil(t, err)
+}
+
+func TestBasicText(t *testing.T) {
+	p, err := ReadText([]byte(`{"code":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, &BasicPkt{Code: CodePing}, p)
+	p, err = ReadText([]byte(`{"command":"chat.user.talk","body":{"message":"hello"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "chat.user.talk", p.(*LogicPkt).Command)
+	_, err = ReadText([]byte(`{"sequence":1}`))
+	assert.NotNil(t, err)
+
+	text, err := MarshalBasicText(&BasicPkt{Code: CodePong})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"code":2}`, string(text))
+	text, err = MarshalBasicText(NewAck(7))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"code":3,"sequence":7}`, string(text))
+	p, err = ReadText(text)
+	assert.Nil(t, err)
+	seq, err := p.(*BasicPkt).AckSequence()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(7), seq)
+}
@@ -11,9 +11,12 @@ const (
 )
 
 type Token struct {
-	Account string `json:"acc,omitempty"`
-	App     string `json:"app,omitempty"`
-	Exp     int64  `json:"exp,omitempty"`
+	// ID is unique for a token so that it can be revoked
+	ID       string `json:"jti,omitempty"`
+	Account  string `json:"acc,omitempty"`
+	App      string `json:"app,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+	IssuedAt int64  `json:"iat,omitempty"`
 }
 
 var errExpiredToken = errors.New("expired token")
@@ -37,6 +40,5 @@ func Parse(secret, tk string) (*Token, error) {
 }
 
 func Generate(secret string, token *Token) (string, error) {
-	jtk := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, token)
-	return jtk.SignedString([]byte(secret))
+	return NewKeyring(NewHMACKey("", secret)).Generate(token)
 }
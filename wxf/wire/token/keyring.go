@@ -0,0 +1,173 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+// Signing algorithms of tokens
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+var (
+	ErrUnknownKey        = errors.New("key of token is unknown")
+	ErrAlgorithmMismatch = errors.New("algorithm of token does not match its key")
+	ErrNoSigningKey      = errors.New("no key to sign tokens")
+)
+
+// Key verifies tokens with ID in their kid header, tokens without kid
+// are verified by the key with an empty ID
+type Key struct {
+	ID     string
+	method jwtgo.SigningMethod
+	// verifyKey is []byte for HS256, *rsa.PublicKey for RS256 and
+	// *ecdsa.PublicKey for ES256
+	verifyKey interface{}
+	// signKey is nil for public keys
+	signKey interface{}
+}
+
+// NewHMACKey returns a HS256 key which both signs and verifies tokens
+func NewHMACKey(id, secret string) *Key {
+	return &Key{
+		ID:        id,
+		method:    jwtgo.SigningMethodHS256,
+		verifyKey: []byte(secret),
+		signKey:   []byte(secret),
+	}
+}
+
+// NewPublicKey returns a RS256 or ES256 key from a PEM encoded public
+// key, it only verifies tokens issued by the holder of private key
+func NewPublicKey(id, algorithm string, pem []byte) (*Key, error) {
+	key := &Key{ID: id}
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		key.method = jwtgo.SigningMethodRS256
+		key.verifyKey, err = jwtgo.ParseRSAPublicKeyFromPEM(pem)
+	case AlgorithmES256:
+		key.method = jwtgo.SigningMethodES256
+		key.verifyKey, err = jwtgo.ParseECPublicKeyFromPEM(pem)
+	default:
+		return nil, fmt.Errorf("algorithm %s of public key is not supported", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewPrivateKey returns a RS256 or ES256 key from a PEM encoded private
+// key, it is used by the auth service to issue tokens
+func NewPrivateKey(id, algorithm string, pem []byte) (*Key, error) {
+	key := &Key{ID: id}
+	switch algorithm {
+	case AlgorithmRS256:
+		priv, err := jwtgo.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		key.method, key.signKey, key.verifyKey = jwtgo.SigningMethodRS256, priv, &priv.PublicKey
+	case AlgorithmES256:
+		priv, err := jwtgo.ParseECPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		key.method, key.signKey, key.verifyKey = jwtgo.SigningMethodES256, priv, &priv.PublicKey
+	default:
+		return nil, fmt.Errorf("algorithm %s of private key is not supported", algorithm)
+	}
+	return key, nil
+}
+
+// Algorithm of key
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// Keyring holds keys of tokens by ID, so that keys can be rotated by
+// adding a new key before the old one is removed
+type Keyring struct {
+	keys   map[string]*Key
+	signer *Key
+	// apps with their own keys, tokens of other apps are verified by keys
+	apps map[string]*Keyring
+}
+
+// NewKeyring returns a keyring of keys, the first key able to sign is
+// used by Generate, so the newest key should be the first
+func NewKeyring(keys ...*Key) *Keyring {
+	k := &Keyring{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		k.keys[key.ID] = key
+		if k.signer == nil && key.signKey != nil {
+			k.signer = key
+		}
+	}
+	return k
+}
+
+// SetApp verifies tokens of app by keyring only, so that tokens of app
+// can not be issued with keys of other apps. It is not safe to be
+// called while parsing tokens
+func (k *Keyring) SetApp(app string, keyring *Keyring) {
+	if k.apps == nil {
+		k.apps = make(map[string]*Keyring)
+	}
+	k.apps[app] = keyring
+}
+
+// Parse verifies tk by the key of its kid, in the keyring of its app if set
+func (k *Keyring) Parse(tk string) (*Token, error) {
+	if len(k.apps) > 0 {
+		var claims Token
+		if _, _, err := new(jwtgo.Parser).ParseUnverified(tk, &claims); err != nil {
+			return nil, err
+		}
+		if keyring, ok := k.apps[claims.App]; ok {
+			return keyring.Parse(tk)
+		}
+	}
+	var token = new(Token)
+	_, err := jwtgo.ParseWithClaims(tk, token, func(t *jwtgo.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		// the algorithm in header is not trusted, e.g. a HS256 token
+		// must not be verified by a public key
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Generate signs token with the signing key, the ID of key is set to
+// kid in header if it is not empty. IssuedAt is set to now if it is 0
+func (k *Keyring) Generate(token *Token) (string, error) {
+	if k.signer == nil {
+		return "", ErrNoSigningKey
+	}
+	if token.IssuedAt == 0 {
+		issued := *token
+		issued.IssuedAt = time.Now().Unix()
+		token = &issued
+	}
+	jtk := jwtgo.NewWithClaims(k.signer.method, token)
+	if k.signer.ID != "" {
+		jtk.Header["kid"] = k.signer.ID
+	}
+	return jtk.SignedString(k.signer.signKey)
+}
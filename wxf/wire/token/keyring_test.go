@@ -0,0 +1,128 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testToken() *Token {
+	return &Token{
+		Account: "test1",
+		App:     "wxf",
+		Exp:     time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func pemOf(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func TestKeyringRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	assert.Nil(t, err)
+
+	signKey, err := NewPrivateKey("k1", AlgorithmRS256, pemOf("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv)))
+	assert.Nil(t, err)
+	tk, err := NewKeyring(signKey).Generate(testToken())
+	assert.Nil(t, err)
+
+	verifyKey, err := NewPublicKey("k1", AlgorithmRS256, pemOf("PUBLIC KEY", pub))
+	assert.Nil(t, err)
+	ring := NewKeyring(verifyKey)
+	tk2, err := ring.Parse(tk)
+	assert.Nil(t, err)
+	assert.Equal(t, "test1", tk2.Account)
+
+	_, err = ring.Generate(testToken())
+	assert.Equal(t, ErrNoSigningKey, err)
+	// public keys are not used as HMAC secrets
+	forged, _ := NewKeyring(NewHMACKey("k1", string(pemOf("PUBLIC KEY", pub)))).Generate(testToken())
+	_, err = ring.Parse(forged)
+	assert.NotNil(t, err)
+}
+
+func TestKeyringES256(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(priv)
+	assert.Nil(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	assert.Nil(t, err)
+
+	signKey, err := NewPrivateKey("k2", AlgorithmES256, pemOf("EC PRIVATE KEY", der))
+	assert.Nil(t, err)
+	tk, err := NewKeyring(signKey).Generate(testToken())
+	assert.Nil(t, err)
+
+	verifyKey, err := NewPublicKey("k2", AlgorithmES256, pemOf("PUBLIC KEY", pub))
+	assert.Nil(t, err)
+	assert.Equal(t, AlgorithmES256, verifyKey.Algorithm())
+	tk2, err := NewKeyring(verifyKey).Parse(tk)
+	assert.Nil(t, err)
+	assert.Equal(t, "wxf", tk2.App)
+
+	_, err = NewPublicKey("k2", AlgorithmRS256, pemOf("PUBLIC KEY", pub))
+	assert.NotNil(t, err)
+	_, err = NewPublicKey("k2", "none", pemOf("PUBLIC KEY", pub))
+	assert.NotNil(t, err)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	// tokens without kid are signed by DefaultSecret
+	legacy, err := Generate(DefaultSecret, testToken())
+	assert.Nil(t, err)
+	old, err := NewKeyring(NewHMACKey("v1", "secret1")).Generate(testToken())
+	assert.Nil(t, err)
+
+	ring := NewKeyring(NewHMACKey("v2", "secret2"), NewHMACKey("v1", "secret1"), NewHMACKey("", DefaultSecret))
+	tk, err := ring.Generate(testToken())
+	assert.Nil(t, err)
+	for _, s := range []string{legacy, old, tk} {
+		_, err = ring.Parse(s)
+		assert.Nil(t, err)
+	}
+	// v2 is the signer
+	_, err = NewKeyring(NewHMACKey("v2", "secret2")).Parse(tk)
+	assert.Nil(t, err)
+
+	// v1 is removed
+	_, err = NewKeyring(NewHMACKey("v2", "secret2")).Parse(old)
+	assert.NotNil(t, err)
+	_, err = NewKeyring(NewHMACKey("", DefaultSecret)).Parse(legacy)
+	assert.Nil(t, err)
+}
+
+func TestKeyringApps(t *testing.T) {
+	ring := NewKeyring(NewHMACKey("", DefaultSecret))
+	ring.SetApp("app1", NewKeyring(NewHMACKey("", "secret1")))
+
+	tk := testToken()
+	tk.App = "app1"
+	s, err := NewKeyring(NewHMACKey("", "secret1")).Generate(tk)
+	assert.Nil(t, err)
+	tk2, err := ring.Parse(s)
+	assert.Nil(t, err)
+	assert.Equal(t, "app1", tk2.App)
+
+	// tokens of app1 can not be issued with the default secret
+	s, err = Generate(DefaultSecret, tk)
+	assert.Nil(t, err)
+	_, err = ring.Parse(s)
+	assert.NotNil(t, err)
+
+	// apps without their own keys are verified by the default keys
+	tk.App = "app2"
+	s, err = Generate(DefaultSecret, tk)
+	assert.Nil(t, err)
+	_, err = ring.Parse(s)
+	assert.Nil(t, err)
+}
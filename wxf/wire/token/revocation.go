@@ -0,0 +1,76 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// Revocations is the list of tokens revoked before they expire, it is
+// checked by gateway after tokens are verified
+type Revocations interface {
+	// RevokeID revokes the token of id, exp is the expiry of the token
+	// after which the revocation can be dropped
+	RevokeID(id string, exp int64) error
+	// RevokeAccount revokes tokens of account in app issued at or before
+	// the unix time before
+	RevokeAccount(app, account string, before int64) error
+	Revoked(tk *Token) (bool, error)
+}
+
+// RevokedBefore reports whether tk is issued at or before the unix time
+// before, tokens without iat are taken as issued before
+func RevokedBefore(tk *Token, before int64) bool {
+	return before > 0 && tk.IssuedAt <= before
+}
+
+func accountKey(app, account string) string {
+	return app + "/" + account
+}
+
+// MemoryRevocations keeps revocations in memory of a process, expired
+// revocations of token ID are dropped when new ones are added. they are
+// not shared by services, so it is for tests only
+type MemoryRevocations struct {
+	sync.RWMutex
+	ids      map[string]int64
+	accounts map[string]int64
+}
+
+func NewMemoryRevocations() *MemoryRevocations {
+	return &MemoryRevocations{
+		ids:      make(map[string]int64),
+		accounts: make(map[string]int64),
+	}
+}
+
+func (m *MemoryRevocations) RevokeID(id string, exp int64) error {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now().Unix()
+	for k, e := range m.ids {
+		if e < now {
+			delete(m.ids, k)
+		}
+	}
+	m.ids[id] = exp
+	return nil
+}
+
+func (m *MemoryRevocations) RevokeAccount(app, account string, before int64) error {
+	m.Lock()
+	defer m.Unlock()
+	key := accountKey(app, account)
+	if before > m.accounts[key] {
+		m.accounts[key] = before
+	}
+	return nil
+}
+
+func (m *MemoryRevocations) Revoked(tk *Token) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	if _, ok := m.ids[tk.ID]; ok && tk.ID != "" {
+		return true, nil
+	}
+	return RevokedBefore(tk, m.accounts[accountKey(tk.App, tk.Account)]), nil
+}
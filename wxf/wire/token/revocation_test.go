@@ -0,0 +1,54 @@
+package token
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryRevocations(t *testing.T) {
+	r := NewMemoryRevocations()
+	now := time.Now().Unix()
+	tk := &Token{ID: "t1", Account: "test1", App: "wxf", IssuedAt: now - 10}
+
+	revoked, err := r.Revoked(tk)
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+
+	assert.Nil(t, r.RevokeID("t1", now+60))
+	revoked, _ = r.Revoked(tk)
+	assert.True(t, revoked)
+	revoked, _ = r.Revoked(&Token{ID: "t2", Account: "test1", App: "wxf", IssuedAt: now - 10})
+	assert.False(t, revoked)
+
+	// tokens of account issued before are revoked, new tokens are not
+	assert.Nil(t, r.RevokeAccount("wxf", "test1", now-5))
+	revoked, _ = r.Revoked(&Token{ID: "t2", Account: "test1", App: "wxf", IssuedAt: now - 10})
+	assert.True(t, revoked)
+	revoked, _ = r.Revoked(&Token{ID: "t3", Account: "test1", App: "wxf", IssuedAt: now})
+	assert.False(t, revoked)
+	// tokens issued in the second of revocation are revoked
+	revoked, _ = r.Revoked(&Token{ID: "t3", Account: "test1", App: "wxf", IssuedAt: now - 5})
+	assert.True(t, revoked)
+	revoked, _ = r.Revoked(&Token{ID: "t4", Account: "test1", App: "other", IssuedAt: now - 10})
+	assert.False(t, revoked)
+	// an earlier revocation does not undo a later one
+	assert.Nil(t, r.RevokeAccount("wxf", "test1", now-100))
+	revoked, _ = r.Revoked(&Token{Account: "test1", App: "wxf", IssuedAt: now - 10})
+	assert.True(t, revoked)
+
+	// expired revocations are dropped
+	assert.Nil(t, r.RevokeID("t5", now-1))
+	assert.Nil(t, r.RevokeID("t6", now+60))
+	assert.Equal(t, 2, len(r.ids))
+}
+
+func TestGenerateIssuedAt(t *testing.T) {
+	tk := testToken()
+	s, err := Generate("secret", tk)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), tk.IssuedAt)
+	tk2, err := Parse("secret", s)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Now().Unix(), tk2.IssuedAt, 2)
+}